@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newServerTLSConfig loads the certificate of the server, if a client CA is given
+// the clients must present a certificate signed by it. It returns nil if TLS is
+// not configured.
+func newServerTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	if cfg == nil || cfg.CertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate: %w", err)
+	}
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client ca %s", cfg.ClientCAFile)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, nil
+}
+
+// newAuthHandler protects `next` with basic auth and bearer token, the request is
+// allowed if it passes any of them. `next` is returned as is if neither of them is
+// configured.
+func newAuthHandler(basicAuthUsers map[string]string, bearerToken string, next http.Handler) http.Handler {
+	if len(basicAuthUsers) == 0 && bearerToken == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); ok {
+			// the passwords are bcrypt hashes
+			if hash, ok := basicAuthUsers[user]; ok && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && bearerToken != "" {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(bearerToken)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if len(basicAuthUsers) != 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,238 @@
+package metrics
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := map[string]string{"venus": string(hash)}
+
+	cases := []struct {
+		name   string
+		users  map[string]string
+		token  string
+		modify func(r *http.Request)
+		want   int
+	}{
+		{name: "no auth configured", want: http.StatusOK},
+		{name: "no credentials", users: users, token: "token", want: http.StatusUnauthorized},
+		{
+			name:  "basic auth",
+			users: users,
+			modify: func(r *http.Request) {
+				r.SetBasicAuth("venus", "secret")
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:  "wrong password",
+			users: users,
+			modify: func(r *http.Request) {
+				r.SetBasicAuth("venus", "guess")
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:  "the hash is not the password",
+			users: users,
+			modify: func(r *http.Request) {
+				r.SetBasicAuth("venus", string(hash))
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:  "bearer token",
+			token: "token",
+			modify: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer token")
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:  "wrong bearer token",
+			token: "token",
+			modify: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer guess")
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:  "bearer token with basic auth configured",
+			users: users,
+			token: "token",
+			modify: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer token")
+			},
+			want: http.StatusOK,
+		},
+		{
+			name:  "empty bearer token is not accepted",
+			users: users,
+			modify: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer ")
+			},
+			want: http.StatusUnauthorized,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/debug/metrics", nil)
+			if c.modify != nil {
+				c.modify(r)
+			}
+			rec := httptest.NewRecorder()
+			newAuthHandler(c.users, c.token, next).ServeHTTP(rec, r)
+			if rec.Code != c.want {
+				t.Errorf("expect %d, got %d", c.want, rec.Code)
+			}
+			// the browsers only ask for the password if basic auth is enabled
+			challenge := rec.Header().Get("WWW-Authenticate") != ""
+			if wantChallenge := c.want == http.StatusUnauthorized && len(c.users) != 0; challenge != wantChallenge {
+				t.Errorf("expect WWW-Authenticate to be set: %v", wantChallenge)
+			}
+		})
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key to
+// `dir`, the certificate is its own CA.
+func writeTestCert(t *testing.T, dir, name string) (certFile, keyFile string, cert tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestPrometheusExporterTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey, _ := writeTestCert(t, dir, "server")
+	clientCA, _, clientCert := writeTestCert(t, dir, "client")
+
+	cfg := newMetricsPrometheusExporterConfig()
+	cfg.EndPoint = "/ip4/127.0.0.1/tcp/0"
+	cfg.TLS = &TLSConfig{CertFile: serverCert, KeyFile: serverKey, ClientCAFile: clientCA}
+	cfg.BearerToken = "token"
+	e, err := newPrometheusExporter(cfg, func() bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Shutdown(context.Background()) //nolint:errcheck
+
+	serverPEM, err := os.ReadFile(serverCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverPEM)
+	get := func(certs []tls.Certificate, token string) (int, error) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+		defer client.CloseIdleConnections()
+		r, err := http.NewRequest(http.MethodGet, "https://"+e.addr.String()+"/debug/metrics", nil)
+		if err != nil {
+			return 0, err
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(r)
+		if err != nil {
+			return 0, err
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if code, err := get([]tls.Certificate{clientCert}, "token"); err != nil || code != http.StatusOK {
+		t.Errorf("expect 200, got %d, %v", code, err)
+	}
+	if code, err := get([]tls.Certificate{clientCert}, "guess"); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("expect 401, got %d, %v", code, err)
+	}
+	if _, err := get(nil, "token"); err == nil {
+		t.Error("expect the client without certificate to be rejected")
+	}
+}
+
+func TestNewServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeTestCert(t, dir, "server")
+	invalidCA := filepath.Join(dir, "invalid.crt")
+	if err := os.WriteFile(invalidCA, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if tlsCfg, err := newServerTLSConfig(&TLSConfig{}); err != nil || tlsCfg != nil {
+		t.Errorf("expect no tls config, got %v, %v", tlsCfg, err)
+	}
+	tlsCfg, err := newServerTLSConfig(&TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg.ClientAuth != tls.NoClientCert {
+		t.Error("expect no client certificate required without client ca")
+	}
+	if _, err := newServerTLSConfig(&TLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")}); err == nil {
+		t.Error("expect the error of the missing key")
+	}
+	if _, err := newServerTLSConfig(&TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: invalidCA}); err == nil {
+		t.Error("expect the error of the invalid client ca")
+	}
+}
@@ -0,0 +1,22 @@
+// default-config writes the commented default metrics and trace config, e.g.
+//
+//	go run github.com/ipfs-force-community/metrics/cmd/default-config -format toml > config.toml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ipfs-force-community/metrics"
+)
+
+func main() {
+	format := flag.String("format", "toml", "config format: toml, yaml or json")
+	flag.Parse()
+
+	if err := metrics.WriteDefaultConfig(os.Stdout, metrics.ConfigFormat(*format)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,349 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the metrics and trace configs in one file, the downstream projects
+// can embed it into their own config.
+type Config struct {
+	Metrics *MetricsConfig `json:"metrics" toml:"Metrics" yaml:"metrics"`
+	Trace   *TraceConfig   `json:"trace" toml:"Trace" yaml:"trace"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Metrics: DefaultMetricsConfig(),
+		Trace:   DefaultTraceConfig(),
+	}
+}
+
+type ConfigFormat string
+
+const (
+	CFJSON ConfigFormat = "json"
+	CFTOML ConfigFormat = "toml"
+	CFYAML ConfigFormat = "yaml"
+)
+
+// ConfigFormatOf returns the format of the config file by its extension
+func ConfigFormatOf(path string) (ConfigFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return CFJSON, nil
+	case ".toml":
+		return CFTOML, nil
+	case ".yaml", ".yml":
+		return CFYAML, nil
+	default:
+		return "", fmt.Errorf("unknown config format of %s", path)
+	}
+}
+
+// DecodeConfig decodes `r` into `cfg`, which is usually *Config, *MetricsConfig
+// or *TraceConfig. The fields missing in `r` keep their values, so `cfg` should
+// be filled with the defaults first. Unknown fields are ignored, so the config
+// can share a file with other sections.
+func DecodeConfig(r io.Reader, format ConfigFormat, cfg interface{}) error {
+	var err error
+	switch format {
+	case CFJSON:
+		err = json.NewDecoder(r).Decode(cfg)
+	case CFTOML:
+		_, err = toml.NewDecoder(r).Decode(cfg)
+	case CFYAML:
+		err = yaml.NewDecoder(r).Decode(cfg)
+		if err == io.EOF {
+			// empty document
+			err = nil
+		}
+	default:
+		return fmt.Errorf("unsupported config format: %s", format)
+	}
+	if err != nil {
+		return fmt.Errorf("decode %s config: %w", format, err)
+	}
+	return nil
+}
+
+// LoadConfigFile decodes the file into `cfg`, the format is decided by the
+// extension of the file.
+func LoadConfigFile(path string, cfg interface{}) error {
+	format, err := ConfigFormatOf(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	return DecodeConfig(f, format, cfg)
+}
+
+// EncodeConfig encodes `cfg` to `w`, the fields are documented by comments in
+// toml and yaml.
+func EncodeConfig(w io.Writer, format ConfigFormat, cfg interface{}) error {
+	switch format {
+	case CFJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cfg)
+	case CFTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+			return fmt.Errorf("encode toml config: %w", err)
+		}
+		_, err := w.Write(commentTOML(buf.Bytes(), reflect.TypeOf(cfg)))
+		return err
+	case CFYAML:
+		var node yaml.Node
+		if err := node.Encode(cfg); err != nil {
+			return fmt.Errorf("encode yaml config: %w", err)
+		}
+		commentYAML(&node, reflect.TypeOf(cfg))
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return fmt.Errorf("encode yaml config: %w", err)
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unsupported config format: %s", format)
+	}
+}
+
+// WriteDefaultConfig writes the commented default Config to `w`.
+func WriteDefaultConfig(w io.Writer, format ConfigFormat) error {
+	cfg := DefaultConfig()
+	// write the exporters with the current field instead of the deprecated one
+	cfg.Metrics.Exporter.Types = cfg.Metrics.Exporter.EnabledTypes()
+	cfg.Metrics.Exporter.Type = ""
+	return EncodeConfig(w, format, cfg)
+}
+
+// commentTOML adds the comments before the keys and the tables of the encoded
+// config of type `t`.
+func commentTOML(data []byte, t reflect.Type) []byte {
+	var out bytes.Buffer
+	var table []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+		var path []string
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			table = strings.Split(strings.Trim(trimmed, "[]"), ".")
+			path = table
+		case strings.Contains(trimmed, "="):
+			key := strings.TrimSpace(trimmed[:strings.Index(trimmed, "=")])
+			path = append(append([]string(nil), table...), key)
+		}
+		if comment := fieldComment(t, "toml", path); comment != "" {
+			for _, l := range strings.Split(comment, "\n") {
+				out.WriteString(indent + "# " + l + "\n")
+			}
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes()
+}
+
+// commentYAML sets the comments of the keys of the mapping nodes, `t` is the
+// type encoded into `node`.
+func commentYAML(node *yaml.Node, t reflect.Type) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			commentYAML(n, t)
+		}
+	case yaml.MappingNode:
+		if t == nil || t.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			f, ok := lookupConfigField(t, "yaml", key.Value)
+			if !ok {
+				continue
+			}
+			if comment, ok := configComments[t.Name()+"."+f.Name]; ok {
+				key.HeadComment = comment
+			}
+			commentYAML(value, f.Type)
+		}
+	case yaml.SequenceNode:
+		if t != nil && t.Kind() == reflect.Slice {
+			for _, n := range node.Content {
+				commentYAML(n, t.Elem())
+			}
+		}
+	}
+}
+
+// fieldComment returns the comment of the field at `path` from type `t`, the
+// names of the path are given by `tag`.
+func fieldComment(t reflect.Type, tag string, path []string) string {
+	for i, name := range path {
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return ""
+		}
+		f, ok := lookupConfigField(t, tag, name)
+		if !ok {
+			return ""
+		}
+		if i == len(path)-1 {
+			return configComments[t.Name()+"."+f.Name]
+		}
+		t = f.Type
+	}
+	return ""
+}
+
+func lookupConfigField(t reflect.Type, tag, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tagName, _, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if tagName == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// configComments documents the config fields by `TypeName.FieldName`
+var configComments = map[string]string{
+	"Config.Metrics": "Metrics exports the opencensus views",
+	"Config.Trace":   "Trace exports the spans",
+
+	"MetricsConfig.Enabled":  "Enabled starts the exporters listed in Exporter.Types",
+	"MetricsConfig.Exporter": "Exporter configures the metrics exporters",
+
+	"MetricsExporterConfig.Type":        "Deprecated: use Types instead",
+	"MetricsExporterConfig.Types":       "Types are the exporters to start: prometheus, graphite, otlp, pushgateway, statsd, influxdb",
+	"MetricsExporterConfig.Prometheus":  "Prometheus serves the metrics to be scraped",
+	"MetricsExporterConfig.Graphite":    "Graphite sends the metrics to carbon",
+	"MetricsExporterConfig.OTLP":        "OTLP pushes the metrics to an opentelemetry collector",
+	"MetricsExporterConfig.Pushgateway": "Pushgateway pushes the metrics of short-lived jobs",
+	"MetricsExporterConfig.Statsd":      "Statsd sends the metrics to a statsd agent",
+	"MetricsExporterConfig.InfluxDB":    "InfluxDB writes the metrics in line protocol",
+
+	"MetricsPrometheusExporterConfig.RegistryType":    "RegistryType is `define` for a dedicated registry, or `default` for the global one",
+	"MetricsPrometheusExporterConfig.Namespace":       "Namespace is prefixed to the metric names",
+	"MetricsPrometheusExporterConfig.EndPoint":        "EndPoint is the multiaddr to listen on, the server is not started if it is empty",
+	"MetricsPrometheusExporterConfig.Path":            "Path is the http path of the metrics",
+	"MetricsPrometheusExporterConfig.ReportingPeriod": "Deprecated: ReportingPeriod is ignored, the interval is decided by the scrape config",
+	"MetricsPrometheusExporterConfig.TLS":             "TLS serves the metrics over https if CertFile is set",
+	"MetricsPrometheusExporterConfig.BasicAuthUsers":  "BasicAuthUsers maps the user names to their bcrypt hashed passwords",
+	"MetricsPrometheusExporterConfig.BearerToken":     "BearerToken is accepted in the Authorization header",
+
+	"MetricsPrometheusExporterConfig.Debug": "Debug selects the debug endpoints served with the metrics",
+
+	"DebugConfig.Pprof":  "Pprof serves net/http/pprof at /debug/pprof/",
+	"DebugConfig.ZPages": "ZPages serves the opencensus zpages at /debug/tracez and /debug/rpcz, it requires importing github.com/ipfs-force-community/metrics/zpages",
+	"DebugConfig.Expvar": "Expvar serves the exported variables at /debug/vars",
+	"DebugConfig.Health": "Health serves /healthz and /readyz without authentication",
+
+	"TLSConfig.CertFile":     "CertFile is the certificate of the server",
+	"TLSConfig.KeyFile":      "KeyFile is the private key of the certificate",
+	"TLSConfig.ClientCAFile": "ClientCAFile requires the clients to present a certificate signed by it",
+
+	"MetricsGraphiteExporterConfig.Namespace":           "Namespace is prefixed to the metric paths",
+	"MetricsGraphiteExporterConfig.Host":                "Host of carbon",
+	"MetricsGraphiteExporterConfig.Port":                "Port of carbon",
+	"MetricsGraphiteExporterConfig.ReportingPeriod":     "ReportingPeriod is the interval to send the metrics",
+	"MetricsGraphiteExporterConfig.Protocol":            "Protocol is `tcp` or `udp` for the plaintext protocol, or `pickle`",
+	"MetricsGraphiteExporterConfig.Tagged":              "Tagged sends the tags as `name;tag=value`, otherwise the tag values are appended to the path",
+	"MetricsGraphiteExporterConfig.BufferSize":          "BufferSize is the max number of points kept while carbon is unavailable, 0 is the default",
+	"MetricsGraphiteExporterConfig.ReconnectBackoff":    "ReconnectBackoff is the first interval to reconnect, it doubles on each failure",
+	"MetricsGraphiteExporterConfig.MaxReconnectBackoff": "MaxReconnectBackoff is the max interval to reconnect",
+
+	"MetricsOTLPExporterConfig.Endpoint":     "Endpoint is the host:port of the collector",
+	"MetricsOTLPExporterConfig.Protocol":     "Protocol is `grpc` or `http`",
+	"MetricsOTLPExporterConfig.Headers":      "Headers are sent with each request",
+	"MetricsOTLPExporterConfig.Compression":  "Compression is `none` or `gzip`",
+	"MetricsOTLPExporterConfig.Insecure":     "Insecure disables TLS",
+	"MetricsOTLPExporterConfig.PushInterval": "PushInterval is the interval to push the metrics",
+
+	"MetricsPushgatewayExporterConfig.URL":              "URL of the pushgateway",
+	"MetricsPushgatewayExporterConfig.Namespace":        "Namespace is prefixed to the metric names",
+	"MetricsPushgatewayExporterConfig.Job":              "Job is the job label of the pushed metrics",
+	"MetricsPushgatewayExporterConfig.Instance":         "Instance is the instance label of the pushed metrics",
+	"MetricsPushgatewayExporterConfig.Grouping":         "Grouping are the extra grouping labels",
+	"MetricsPushgatewayExporterConfig.Username":         "Username of basic auth",
+	"MetricsPushgatewayExporterConfig.Password":         "Password of basic auth",
+	"MetricsPushgatewayExporterConfig.PushInterval":     "PushInterval is the interval to push the metrics",
+	"MetricsPushgatewayExporterConfig.DeleteOnShutdown": "DeleteOnShutdown deletes the metrics from the pushgateway on shutdown",
+
+	"MetricsStatsdExporterConfig.Network":         "Network is `udp` or `unixgram`",
+	"MetricsStatsdExporterConfig.Address":         "Address of the statsd agent",
+	"MetricsStatsdExporterConfig.Namespace":       "Namespace is prefixed to the metric names",
+	"MetricsStatsdExporterConfig.DogStatsD":       "DogStatsD sends the tags in the DogStatsD format",
+	"MetricsStatsdExporterConfig.MaxPacketSize":   "MaxPacketSize is the max size of the packets",
+	"MetricsStatsdExporterConfig.ReportingPeriod": "ReportingPeriod is the interval to send the metrics",
+
+	"MetricsInfluxDBExporterConfig.Protocol":        "Protocol is `http` for the v2 write api, or `udp`",
+	"MetricsInfluxDBExporterConfig.URL":             "URL of influxdb, used by http",
+	"MetricsInfluxDBExporterConfig.Org":             "Org to write to, used by http",
+	"MetricsInfluxDBExporterConfig.Bucket":          "Bucket to write to, used by http",
+	"MetricsInfluxDBExporterConfig.Token":           "Token to authenticate, used by http",
+	"MetricsInfluxDBExporterConfig.Address":         "Address of influxdb, used by udp",
+	"MetricsInfluxDBExporterConfig.MaxPacketSize":   "MaxPacketSize is the max size of the packets, used by udp",
+	"MetricsInfluxDBExporterConfig.Namespace":       "Namespace is prefixed to the measurement names",
+	"MetricsInfluxDBExporterConfig.MaxRetries":      "MaxRetries is the max times to retry a failed write",
+	"MetricsInfluxDBExporterConfig.RetryBackoff":    "RetryBackoff is the first interval to retry, it doubles on each retry",
+	"MetricsInfluxDBExporterConfig.ReportingPeriod": "ReportingPeriod is the interval to write the metrics",
+
+	"TraceConfig.JaegerTracingEnabled": "JaegerTracingEnabled is kept for compatibility, it enables tracing like TracingEnabled",
+	"TraceConfig.ProbabilitySampler":   "ProbabilitySampler is the ratio of the sampled traces, in [0, 1]",
+	"TraceConfig.JaegerEndpoint":       "JaegerEndpoint is host:port of the agent, or the url of the collector",
+	"TraceConfig.ServerName":           "ServerName overrides the service name of the spans",
+	"TraceConfig.JaegerMode":           "JaegerMode is `agent` or `collector`, inferred from JaegerEndpoint if empty",
+	"TraceConfig.JaegerMaxPacketSize":  "JaegerMaxPacketSize is the max size of the udp packets to the agent",
+	"TraceConfig.JaegerUsername":       "JaegerUsername of the collector",
+	"TraceConfig.JaegerPassword":       "JaegerPassword of the collector",
+	"TraceConfig.TracingEnabled":       "TracingEnabled starts the exporter chosen by Exporter",
+	"TraceConfig.Exporter":             "Exporter is `jaeger`, `otlp` or `zipkin`",
+	"TraceConfig.OTLP":                 "OTLP pushes the spans to an opentelemetry collector",
+	"TraceConfig.ZipkinEndpoint":       "ZipkinEndpoint is the url of the zipkin span api",
+	"TraceConfig.Sampler":              "Sampler overrides the plain ratio sampler",
+	"TraceConfig.Propagators":          "Propagators are the formats of the trace context: tracecontext, baggage, b3, b3multi, jaeger",
+
+	"TraceOTLPExporterConfig.Endpoint":    "Endpoint is the host:port of the collector",
+	"TraceOTLPExporterConfig.Protocol":    "Protocol is `grpc` or `http`",
+	"TraceOTLPExporterConfig.Headers":     "Headers are sent with each request",
+	"TraceOTLPExporterConfig.Compression": "Compression is `none` or `gzip`",
+	"TraceOTLPExporterConfig.Insecure":    "Insecure disables TLS",
+
+	"TraceSamplerConfig.Type":          "Type is `always_on`, `always_off`, `ratio` or `rate_limiting`",
+	"TraceSamplerConfig.RatePerSecond": "RatePerSecond is the max spans sampled per second by rate_limiting",
+	"TraceSamplerConfig.ParentBased":   "ParentBased follows the sampling decision of the parent span, Type and Rules only apply to the root spans",
+	"TraceSamplerConfig.Rules":         "Rules sample the matched spans by their own sampler",
+
+	"TraceSamplerRule.SpanName":      "SpanName matches the span name exactly, or by prefix if it ends with `*`",
+	"TraceSamplerRule.Attributes":    "Attributes must all be set when the span starts",
+	"TraceSamplerRule.Type":          "Type is the sampler of the matched spans",
+	"TraceSamplerRule.Ratio":         "Ratio of the ratio sampler",
+	"TraceSamplerRule.RatePerSecond": "RatePerSecond of the rate_limiting sampler",
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipfs-force-community/metrics/tracing"
+)
+
+func newTestConfig() *Config {
+	cfg := DefaultConfig()
+	cfg.Metrics.Enabled = true
+	cfg.Metrics.Exporter.Types = []ExporterType{ETPrometheus, ETStatsd}
+	cfg.Metrics.Exporter.Prometheus.BasicAuthUsers = map[string]string{"venus": "$2a$10$hash"}
+	cfg.Metrics.Exporter.Pushgateway.Grouping = map[string]string{"zone": "sh"}
+	cfg.Trace.TracingEnabled = true
+	cfg.Trace.ProbabilitySampler = 0.5
+	cfg.Trace.Propagators = []string{tracing.PropagatorTraceContext, tracing.PropagatorB3}
+	cfg.Trace.Sampler = &TraceSamplerConfig{
+		Type:        STRatio,
+		ParentBased: true,
+		Rules: []*TraceSamplerRule{
+			{SpanName: "HTTP POST", Attributes: map[string]string{"http.target": "/rpc/v1"}, Type: STAlwaysOn},
+		},
+	}
+	return cfg
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	for _, format := range []ConfigFormat{CFJSON, CFTOML, CFYAML} {
+		t.Run(string(format), func(t *testing.T) {
+			want := newTestConfig()
+			var buf bytes.Buffer
+			if err := EncodeConfig(&buf, format, want); err != nil {
+				t.Fatal(err)
+			}
+
+			got := &Config{}
+			if err := DecodeConfig(&buf, format, got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expect %+v, got %+v", want, got)
+			}
+		})
+	}
+}
+
+// the fields missing in the file keep the defaults, and the other sections of
+// the file are ignored
+func TestDecodeConfigDefaults(t *testing.T) {
+	cases := []struct {
+		format ConfigFormat
+		data   string
+	}{
+		{
+			format: CFJSON,
+			data:   `{"api": {"listen": "/ip4/0.0.0.0/tcp/1234"}, "trace": {"jaegerTracingEnabled": true, "servername": "venus-auth"}}`,
+		},
+		{
+			// the section of venus-auth
+			format: CFTOML,
+			data: `
+[API]
+  Listen = "/ip4/0.0.0.0/tcp/1234"
+
+[Trace]
+  JaegerTracingEnabled = true
+  ServerName = "venus-auth"
+`,
+		},
+		{
+			format: CFYAML,
+			data: `
+api:
+  listen: /ip4/0.0.0.0/tcp/1234
+trace:
+  jaegerTracingEnabled: true
+  servername: venus-auth
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.format), func(t *testing.T) {
+			cfg := DefaultConfig()
+			if err := DecodeConfig(strings.NewReader(c.data), c.format, cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			want := DefaultConfig()
+			want.Trace.JaegerTracingEnabled = true
+			want.Trace.ServerName = "venus-auth"
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("expect %+v, got %+v", want, cfg)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	if err := DecodeConfig(strings.NewReader(""), CFYAML, DefaultConfig()); err != nil {
+		t.Errorf("expect the empty yaml to be accepted, got %s", err)
+	}
+	if err := DecodeConfig(strings.NewReader("[Trace"), CFTOML, DefaultConfig()); err == nil {
+		t.Error("expect the error of the invalid toml")
+	}
+	if err := DecodeConfig(strings.NewReader("{}"), "ini", DefaultConfig()); err == nil {
+		t.Error("expect the error of the unknown format")
+	}
+}
+
+func TestConfigFormatOf(t *testing.T) {
+	cases := map[string]ConfigFormat{
+		"config.json":      CFJSON,
+		"/etc/venus.toml":  CFTOML,
+		"config.yaml":      CFYAML,
+		"config.YML":       CFYAML,
+		"config.toml.bak":  "",
+		"config":           "",
+		"config.toml/yaml": "",
+	}
+	for path, want := range cases {
+		got, err := ConfigFormatOf(path)
+		if want == "" {
+			if err == nil {
+				t.Errorf("expect the error of %s, got %s", path, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("expect %s of %s, got %s, %v", want, path, got, err)
+		}
+	}
+}
+
+func TestWriteDefaultConfig(t *testing.T) {
+	cases := []struct {
+		format   ConfigFormat
+		comments []string
+	}{
+		{
+			format: CFTOML,
+			comments: []string{
+				"# Metrics exports the opencensus views\n[Metrics]",
+				"  # Types are the exporters to start",
+				"      # Path is the http path of the metrics\n      Path = ",
+			},
+		},
+		{
+			format: CFYAML,
+			comments: []string{
+				"# Metrics exports the opencensus views\nmetrics:",
+				"    # Types are the exporters to start",
+				"      # Path is the http path of the metrics\n      path: ",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteDefaultConfig(&buf, c.format); err != nil {
+				t.Fatal(err)
+			}
+			for _, comment := range c.comments {
+				if !strings.Contains(buf.String(), comment) {
+					t.Errorf("expect %q in the config:\n%s", comment, buf.String())
+				}
+			}
+
+			// the written config is the default one
+			cfg := &Config{}
+			if err := DecodeConfig(&buf, c.format, cfg); err != nil {
+				t.Fatal(err)
+			}
+			want := DefaultConfig()
+			want.Metrics.Exporter.Types = want.Metrics.Exporter.EnabledTypes()
+			want.Metrics.Exporter.Type = ""
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("expect %+v, got %+v", want, cfg)
+			}
+		})
+	}
+}
+
+// every field written to the config files is documented
+func TestConfigCommentsComplete(t *testing.T) {
+	seen := map[reflect.Type]bool{}
+	var check func(t reflect.Type)
+	check = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct || seen[typ] {
+			return
+		}
+		seen[typ] = true
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if f.Tag.Get("toml") == "" || f.Tag.Get("toml") == "-" {
+				continue
+			}
+			if _, ok := configComments[typ.Name()+"."+f.Name]; !ok {
+				t.Errorf("expect the comment of %s.%s", typ.Name(), f.Name)
+			}
+			check(f.Type)
+		}
+	}
+	check(reflect.TypeOf(Config{}))
+}
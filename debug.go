@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// ZPagesHandler mounts the opencensus zpages at /debug/tracez and /debug/rpcz,
+// it is set by importing github.com/ipfs-force-community/metrics/zpages.
+var ZPagesHandler func(mux *http.ServeMux)
+
+// RegisterDebugHandlers mounts the debug endpoints enabled by `cfg` on `mux`, so
+// they can be served by an existing application router:
+//   - pprof at /debug/pprof/
+//   - opencensus zpages at /debug/tracez and /debug/rpcz, if the zpages
+//     subpackage is imported
+//   - expvar at /debug/vars
+//   - liveness at /healthz and readiness at /readyz, the readiness is the json
+//     report of DefaultHealthRegistry
+func RegisterDebugHandlers(mux *http.ServeMux, cfg *DebugConfig) {
+	registerDebugHandlers(mux, cfg)
+	if cfg != nil && cfg.Health {
+		registerHealthHandlers(mux, func() bool { return true })
+	}
+}
+
+// registerDebugHandlers mounts the debug endpoints except the health ones, which
+// are served without authentication.
+func registerDebugHandlers(mux *http.ServeMux, cfg *DebugConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.Pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	if cfg.ZPages {
+		if ZPagesHandler != nil {
+			ZPagesHandler(mux)
+		} else {
+			log.Warn("zpages are enabled but not served, import github.com/ipfs-force-community/metrics/zpages to serve them")
+		}
+	}
+	if cfg.Expvar {
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+}
+
+// registerHealthHandlers serves the liveness, which is ok as long as the server
+// responds, and the readiness, which requires `ready` and the critical checks of
+// DefaultHealthRegistry to pass.
+func registerHealthHandlers(mux *http.ServeMux, ready func() bool) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := DefaultHealthRegistry.Report(r.Context())
+		if !ready() {
+			report.Status = HSFailing
+			report.Checks["metrics"] = HealthResult{
+				Status:   HSFailing,
+				Error:    "metrics exporters are not started",
+				Critical: true,
+			}
+		}
+		writeHealthReport(w, report)
+	})
+}
@@ -4,21 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
-	"contrib.go.opencensus.io/exporter/graphite"
 	"contrib.go.opencensus.io/exporter/prometheus"
 	logging "github.com/ipfs/go-log/v2"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 	promclient "github.com/prometheus/client_golang/prometheus"
-	"go.opencensus.io/stats/view"
-	"go.opentelemetry.io/otel/bridge/opencensus"
-	"go.opentelemetry.io/otel/exporters/jaeger"
-	"go.opentelemetry.io/otel/sdk/resource"
-	tracesdk "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opencensus.io/metric/metricexport"
 )
 
 var log = logging.Logger("metrics")
@@ -30,22 +25,79 @@ const (
 	RTDefine  RegistryType = "define"
 )
 
+// exporter is a started metrics exporter
+type exporter interface {
+	// Shutdown flushes the pending metrics and stops the exporter
+	Shutdown(ctx context.Context) error
+}
+
+// startIntervalReader exports the metrics of all the views to `exporter` every
+// reporting period. Each push exporter has its own reader, so their periods do
+// not interfere with each other, unlike the global view.SetReportingPeriod.
+func startIntervalReader(exporter metricexport.Exporter, reportingPeriod string) (*metricexport.IntervalReader, error) {
+	reportPeriod, err := time.ParseDuration(reportingPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	ir, err := metricexport.NewIntervalReader(metricexport.NewReader(), exporter)
+	if err != nil {
+		return nil, err
+	}
+	ir.ReportingInterval = reportPeriod
+	if err := ir.Start(); err != nil {
+		return nil, err
+	}
+	return ir, nil
+}
+
 // RegisterPrometheusExporter register the prometheus exporter
 func RegisterPrometheusExporter(ctx context.Context, cfg *MetricsPrometheusExporterConfig) error {
-	// validate config values and marshal to types
-	reportPeriod, err := time.ParseDuration(cfg.ReportingPeriod)
+	e, err := newPrometheusExporter(cfg, func() bool { return true })
 	if err != nil {
 		return err
 	}
 
-	promma, err := ma.NewMultiaddr(cfg.EndPoint)
-	if err != nil {
-		return err
+	go func() {
+		<-ctx.Done()
+		log.Info("context done")
+
+		if err := e.Shutdown(context.TODO()); err != nil {
+			log.Errorf("shutting down prometheus server failed: %s", err)
+		}
+	}()
+
+	return <-e.serveErr
+}
+
+type prometheusExporter struct {
+	pe       *prometheus.Exporter
+	registry *collectorRecorder
+	handler  http.Handler
+	// srv, lst and addr are nil if the exporter does not listen
+	srv      *http.Server
+	lst      manet.Listener
+	addr     net.Addr
+	serveErr chan error
+}
+
+// newPrometheusExporter listens on the endpoint and starts serving the metrics
+// and the debug endpoints, the server is not started if the endpoint is empty,
+// the handler can be served by the application router then. `ready` reports
+// the readiness served by the health endpoints.
+func newPrometheusExporter(cfg *MetricsPrometheusExporterConfig, ready func() bool) (*prometheusExporter, error) {
+	// the metrics are read on each scrape, setting the reporting period globally
+	// would override the other exporters
+	if cfg.ReportingPeriod != "" {
+		log.Warnf("prometheus exporter ignores the deprecated reportingPeriod %s, the metrics are read on each scrape", cfg.ReportingPeriod)
 	}
 
-	lst, err := manet.Listen(promma)
-	if err != nil {
-		return fmt.Errorf("could not listen: %w", err)
+	var promma ma.Multiaddr
+	if cfg.EndPoint != "" {
+		var err error
+		if promma, err = ma.NewMultiaddr(cfg.EndPoint); err != nil {
+			return nil, err
+		}
 	}
 
 	// setup prometheus
@@ -59,7 +111,7 @@ func RegisterPrometheusExporter(ctx context.Context, cfg *MetricsPrometheusExpor
 		// defensive in case things change under the hood.
 		registry, ok = promclient.DefaultRegisterer.(*promclient.Registry)
 		if !ok {
-			return fmt.Errorf("failed to export default prometheus registry; some metrics will be unavailable; unexpected type: %T", promclient.DefaultRegisterer)
+			return nil, fmt.Errorf("failed to export default prometheus registry; some metrics will be unavailable; unexpected type: %T", promclient.DefaultRegisterer)
 		}
 	case RTDefine:
 		// The metrics of OpenCensus in the same process will be automatically
@@ -67,129 +119,201 @@ func RegisterPrometheusExporter(ctx context.Context, cfg *MetricsPrometheusExpor
 		// registration action is required
 		registry = promclient.NewRegistry()
 	default:
-		return fmt.Errorf("wrong registry type: %s", cfg.RegistryType)
+		return nil, fmt.Errorf("wrong registry type: %s", cfg.RegistryType)
 	}
 
+	// the collector is unregistered on shutdown, so the exporter can be created
+	// again with the same registry on reload
+	recorder := &collectorRecorder{Registerer: registry}
 	pe, err := prometheus.NewExporter(prometheus.Options{
-		Namespace: cfg.Namespace,
-		Registry:  registry,
+		Namespace:  cfg.Namespace,
+		Registry:   registry,
+		Registerer: recorder,
 	})
 	if err != nil {
-		return fmt.Errorf("could not create the prometheus stats exporter: %w", err)
+		return nil, fmt.Errorf("could not create the prometheus stats exporter: %w", err)
+	}
+	if err := recorder.Register(&summaryCollector{namespace: cfg.Namespace}); err != nil {
+		recorder.unregisterAll()
+		return nil, fmt.Errorf("could not register the summary collector: %w", err)
 	}
 
-	view.RegisterExporter(pe)
-	view.SetReportingPeriod(reportPeriod)
+	tlsCfg, err := newServerTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
 
+	// the health endpoints are open to the probes, the others require auth
+	protected := http.NewServeMux()
+	protected.Handle(cfg.Path, pe)
+	registerDebugHandlers(protected, cfg.Debug)
 	mux := http.NewServeMux()
-	mux.Handle(cfg.Path, pe)
-	srv := &http.Server{
-		Handler: mux,
+	mux.Handle("/", newAuthHandler(cfg.BasicAuthUsers, cfg.BearerToken, protected))
+	if cfg.Debug != nil && cfg.Debug.Health {
+		registerHealthHandlers(mux, ready)
 	}
 
-	go func() {
+	e := &prometheusExporter{
+		pe:       pe,
+		registry: recorder,
+		handler:  mux,
+		serveErr: make(chan error, 1),
+	}
+	if promma == nil {
+		log.Info("Start prometheus exporter without listener")
+		return e, nil
+	}
 
-		<-ctx.Done()
-		log.Info("context done")
+	lst, err := manet.Listen(promma)
+	if err != nil {
+		e.registry.unregisterAll()
+		return nil, fmt.Errorf("could not listen: %w", err)
+	}
+	e.lst = lst
+	e.addr = lst.Addr()
+	e.srv = &http.Server{
+		Handler:   mux,
+		TLSConfig: tlsCfg,
+	}
 
-		view.UnregisterExporter(pe)
-		if err := srv.Shutdown(context.TODO()); err != nil {
-			log.Errorf("shutting down prometheus server failed: %s", err)
+	go func() {
+		log.Info("Start prometheus exporter server ", lst.Addr())
+		var err error
+		if tlsCfg != nil {
+			// the certificate is loaded in TLSConfig already
+			err = e.srv.ServeTLS(manet.NetListener(lst), "", "")
+		} else {
+			err = e.srv.Serve(manet.NetListener(lst))
+		}
+		if err != http.ErrServerClosed {
+			e.serveErr <- err
+			return
 		}
+		log.Infof("prometheus exporter server graceful shutdown successful")
+		e.serveErr <- nil
 	}()
 
-	log.Info("Start prometheus exporter server ", lst.Addr())
-	return srv.Serve(manet.NetListener(lst))
+	return e, nil
 }
 
-func RegisterGraphiteExporter(ctx context.Context, cfg *MetricsGraphiteExporterConfig) error {
-	exporter, err := graphite.NewExporter(graphite.Options{Namespace: cfg.Namespace, Host: cfg.Host, Port: cfg.Port})
-	if err != nil {
-		return fmt.Errorf("failed to create graphite exporter: %w", err)
+// Shutdown stops the prometheus server, the metrics are pulled on each scrape,
+// so there is nothing to flush.
+func (e *prometheusExporter) Shutdown(ctx context.Context) error {
+	e.registry.unregisterAll()
+	if e.srv == nil {
+		e.serveErr <- nil
+		return nil
 	}
+	err := e.srv.Shutdown(ctx)
+	// the listener is closed by Serve too, but it may not be called yet, then
+	// the endpoint is still bound when the exporter is started again on reload
+	_ = e.lst.Close()
+	return err
+}
 
-	view.RegisterExporter(exporter)
+// collectorRecorder records the collectors registered through it, so they can
+// be unregistered later.
+type collectorRecorder struct {
+	promclient.Registerer
+	collectors []promclient.Collector
+}
 
-	reportPeriod, err := time.ParseDuration(cfg.ReportingPeriod)
-	if err != nil {
+func (r *collectorRecorder) Register(c promclient.Collector) error {
+	if err := r.Registerer.Register(c); err != nil {
 		return err
 	}
-	view.SetReportingPeriod(reportPeriod)
-
-	go func() {
-		<-ctx.Done()
-		log.Info("context done")
+	r.collectors = append(r.collectors, c)
+	return nil
+}
 
-		view.UnregisterExporter(exporter)
-	}()
+func (r *collectorRecorder) MustRegister(cs ...promclient.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
 
-	return nil
+func (r *collectorRecorder) unregisterAll() {
+	for _, c := range r.collectors {
+		r.Registerer.Unregister(c)
+	}
+	r.collectors = nil
 }
 
-func SetupMetrics(ctx context.Context, cfg *MetricsConfig) error {
+// SetupMetrics starts all the enabled exporters, if any of them fails to start,
+// the started ones are stopped and the error is returned. The exporters are
+// stopped when `ctx` is done or when the returned handle is shut down.
+func SetupMetrics(ctx context.Context, cfg *MetricsConfig) (*MetricsHandle, error) {
 	// log config
-	b, err := json.MarshalIndent(cfg, "", "  ")
+	b, err := json.MarshalIndent(cfg.masked(), "", "  ")
 	if err != nil {
-		return fmt.Errorf("marshal metrics config: %w", err)
+		return nil, fmt.Errorf("marshal metrics config: %w", err)
 	}
 	log.Infof("metrics config: %s", string(b))
 
-	if cfg.Enabled {
-		switch cfg.Exporter.Type {
-		case ETPrometheus:
-			go func() {
-				if err := RegisterPrometheusExporter(ctx, cfg.Exporter.Prometheus); err != nil {
-					log.Errorf("failed to register prometheus exporter err: %v", err)
-				}
-				log.Infof("prometheus exporter server graceful shutdown successful")
-			}()
-
-		case ETGraphite:
-			if err := RegisterGraphiteExporter(ctx, cfg.Exporter.Graphite); err != nil {
-				log.Errorf("failed to register graphite exporter: %v", err)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid metrics config: %w", err)
+	}
+
+	h := newMetricsHandle()
+	if err := h.startAll(ctx, cfg); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Info("context done")
+			if err := h.Shutdown(context.TODO()); err != nil {
+				log.Errorf("shutting down metrics exporters failed: %s", err)
 			}
-		default:
-			log.Warnf("invalid exporter type: %s", cfg.Exporter.Type)
+		case <-h.done:
 		}
-	}
+	}()
 
-	return nil
+	return h, nil
 }
 
-// SetupJaegerTracing setups the jaeger endpoint and names the
-// tracer.
-func SetupJaegerTracing(serviceName string, cfg *TraceConfig) (*tracesdk.TracerProvider, error) {
-	if !cfg.JaegerTracingEnabled {
-		return nil, nil
-	}
+// maskedSecret replaces the secrets in the logged config
+const maskedSecret = "******"
 
-	if len(cfg.ServerName) != 0 {
-		serviceName = cfg.ServerName
+// masked returns a copy of the config whose secrets are masked, so it can be
+// logged. The configs of the exporters are copied only if they have secrets.
+func (c *MetricsConfig) masked() *MetricsConfig {
+	cfg := *c
+	if c.Exporter == nil {
+		return &cfg
 	}
-
-	je, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(cfg.JaegerEndpoint)))
-	if err != nil {
-		return nil, err
+	exporter := *c.Exporter
+	cfg.Exporter = &exporter
+
+	if p := exporter.Prometheus; p != nil {
+		prometheus := *p
+		maskSecret(&prometheus.BearerToken)
+		if len(p.BasicAuthUsers) > 0 {
+			prometheus.BasicAuthUsers = make(map[string]string, len(p.BasicAuthUsers))
+			for user := range p.BasicAuthUsers {
+				prometheus.BasicAuthUsers[user] = maskedSecret
+			}
+		}
+		exporter.Prometheus = &prometheus
 	}
-	tp := tracesdk.NewTracerProvider(
-		// Always be sure to batch in production.
-		tracesdk.WithBatcher(je),
-		// Record information about this application in an Resource.
-		tracesdk.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(serviceName),
-		)),
-		tracesdk.WithSampler(tracesdk.TraceIDRatioBased(cfg.ProbabilitySampler)),
-	)
-
-	opencensus.InstallTraceBridge(opencensus.WithTracerProvider(tp))
-
-	return tp, err
+	if p := exporter.Pushgateway; p != nil {
+		pushgateway := *p
+		maskSecret(&pushgateway.Password)
+		exporter.Pushgateway = &pushgateway
+	}
+	if i := exporter.InfluxDB; i != nil {
+		influxDB := *i
+		maskSecret(&influxDB.Token)
+		exporter.InfluxDB = &influxDB
+	}
+	return &cfg
 }
 
-func ShutdownJaeger(ctx context.Context, je *tracesdk.TracerProvider) error {
-	if err := je.ForceFlush(ctx); err != nil {
-		log.Warnf("failed to flush jaeger: %w", err)
+func maskSecret(s *string) {
+	if *s != "" {
+		*s = maskedSecret
 	}
-	return je.Shutdown(ctx)
 }
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMetricsConfigMasked(t *testing.T) {
+	cfg := DefaultMetricsConfig()
+	cfg.Exporter.Prometheus.BearerToken = "secret-bearer"
+	cfg.Exporter.Prometheus.BasicAuthUsers = map[string]string{"admin": "secret-hash"}
+	cfg.Exporter.Pushgateway.Password = "secret-password"
+	cfg.Exporter.InfluxDB.Token = "secret-token"
+
+	b, err := json.Marshal(cfg.masked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("the secrets are logged: %s", b)
+	}
+	if !strings.Contains(string(b), `"admin":"******"`) {
+		t.Errorf("expect the user names to be logged: %s", b)
+	}
+
+	if cfg.Exporter.Prometheus.BearerToken != "secret-bearer" ||
+		cfg.Exporter.Prometheus.BasicAuthUsers["admin"] != "secret-hash" ||
+		cfg.Exporter.Pushgateway.Password != "secret-password" ||
+		cfg.Exporter.InfluxDB.Token != "secret-token" {
+		t.Errorf("the config is changed")
+	}
+}
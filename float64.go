@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Float64 wraps an opencensus float64 measure that is uses as a gauge.
+type Float64 struct {
+	value     float64
+	measureCt *stats.Float64Measure
+	view      *view.View
+
+	mux sync.Mutex
+}
+
+// Set sets the value to `v`.
+func (f *Float64) Set(ctx context.Context, v float64) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.value = v
+	stats.Record(ctx, f.measureCt.M(f.value))
+}
+
+// Inc increments the inner value by value `v`.
+func (f *Float64) Inc(ctx context.Context, v float64) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.value += v
+	stats.Record(ctx, f.measureCt.M(f.value))
+}
+
+// NewFloat64 creates a new Float64 Gauge
+func NewFloat64(name, desc string, unit string, keys ...tag.Key) *Float64 {
+	f, err := TryNewFloat64(name, desc, unit, keys...)
+	if err != nil {
+		// a panic here indicates a developer error when creating a view.
+		// Since this method is called in init() methods, this panic when hit
+		// will cause running the program to fail immediately.
+		panic(err)
+	}
+	return f
+}
+
+// TryNewFloat64 is NewFloat64 returning the error instead of panic
+func TryNewFloat64(name, desc string, unit string, keys ...tag.Key) (*Float64, error) {
+	m, err := newFloat64View("Float64", name, name, desc, unit, view.LastValue(), keys, func(fMeasure *stats.Float64Measure, fView *view.View) interface{} {
+		return &Float64{
+			measureCt: fMeasure,
+			view:      fView,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*Float64), nil
+}
+
+// NewFloat64Gauge is just the alias of NewFloat64
+func NewFloat64Gauge(name, desc string, unit string, keys ...tag.Key) *Float64 {
+	return NewFloat64(name, desc, unit, keys...)
+}
+
+// TryNewFloat64Gauge is just the alias of TryNewFloat64
+func TryNewFloat64Gauge(name, desc string, unit string, keys ...tag.Key) (*Float64, error) {
+	return TryNewFloat64(name, desc, unit, keys...)
+}
+
+// Float64Counter is a monotonic counter of float64 amounts, it is exported with
+// the `_total` suffix like SumCounter.
+type Float64Counter struct {
+	measureCt *stats.Float64Measure
+	view      *view.View
+}
+
+// Add increments the counter by `n`, the negative `n` is rejected.
+func (c *Float64Counter) Add(ctx context.Context, n float64) error {
+	if n < 0 {
+		return fmt.Errorf("counter %s can not be decreased by %v", c.view.Name, n)
+	}
+	stats.Record(ctx, c.measureCt.M(n))
+	return nil
+}
+
+// NewFloat64Counter creates a new Float64Counter
+func NewFloat64Counter(name, desc string, unit string, keys ...tag.Key) *Float64Counter {
+	c, err := TryNewFloat64Counter(name, desc, unit, keys...)
+	if err != nil {
+		// a panic here indicates a developer error when creating a view.
+		// Since this method is called in init() methods, this panic when hit
+		// will cause running the program to fail immediately.
+		panic(err)
+	}
+	return c
+}
+
+// TryNewFloat64Counter is NewFloat64Counter returning the error instead of panic
+func TryNewFloat64Counter(name, desc string, unit string, keys ...tag.Key) (*Float64Counter, error) {
+	m, err := newFloat64View("Float64Counter", counterName(name), counterName(name), desc, unit, view.Sum(), keys, func(fMeasure *stats.Float64Measure, fView *view.View) interface{} {
+		return &Float64Counter{
+			measureCt: fMeasure,
+			view:      fView,
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*Float64Counter), nil
+}
+
+type Float64WithCategory struct {
+	value map[string]float64
+
+	measureCt *stats.Float64Measure
+	view      *view.View
+
+	mux sync.Mutex
+}
+
+// Set sets the value to `v`.
+func (f *Float64WithCategory) Set(ctx context.Context, category string, v float64) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	ctx, _ = tag.New(ctx, tag.Insert(tagCategory, category))
+
+	f.value[category] = v
+	stats.Record(ctx, f.measureCt.M(f.value[category]))
+}
+
+// Inc increments the inner value by value `v`.
+func (f *Float64WithCategory) Inc(ctx context.Context, category string, v float64) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	ctx, _ = tag.New(ctx, tag.Insert(tagCategory, category))
+
+	f.value[category] += v
+	stats.Record(ctx, f.measureCt.M(f.value[category]))
+}
+
+func NewFloat64WithCategory(name, desc string, unit string, keys ...tag.Key) *Float64WithCategory {
+	f, err := TryNewFloat64WithCategory(name, desc, unit, keys...)
+	if err != nil {
+		// a panic here indicates a developer error when creating a view.
+		// Since this method is called in init() methods, this panic when hit
+		// will cause running the program to fail immediately.
+		panic(err)
+	}
+	return f
+}
+
+// TryNewFloat64WithCategory is NewFloat64WithCategory returning the error instead
+// of panic
+func TryNewFloat64WithCategory(name, desc string, unit string, keys ...tag.Key) (*Float64WithCategory, error) {
+	keys = append(keys, tagCategory)
+	m, err := newFloat64View("Float64WithCategory", name, name, desc, unit, view.LastValue(), keys, func(fMeasure *stats.Float64Measure, fView *view.View) interface{} {
+		return &Float64WithCategory{
+			measureCt: fMeasure,
+			view:      fView,
+			value:     make(map[string]float64),
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*Float64WithCategory), nil
+}
+
+// Float64CounterWithCategory is a Float64Counter with the category tag
+type Float64CounterWithCategory Float64Counter
+
+// Add increments the counter of `category` by `n`, the negative `n` is rejected.
+func (c *Float64CounterWithCategory) Add(ctx context.Context, category string, n float64) error {
+	ctx, err := tag.New(ctx, tag.Insert(tagCategory, category))
+	if err != nil {
+		return err
+	}
+	return (*Float64Counter)(c).Add(ctx, n)
+}
+
+func NewFloat64CounterWithCategory(name, desc string, unit string, keys ...tag.Key) *Float64CounterWithCategory {
+	keys = append(keys, tagCategory)
+	return (*Float64CounterWithCategory)(NewFloat64Counter(name, desc, unit, keys...))
+}
+
+// TryNewFloat64CounterWithCategory is NewFloat64CounterWithCategory returning the
+// error instead of panic
+func TryNewFloat64CounterWithCategory(name, desc string, unit string, keys ...tag.Key) (*Float64CounterWithCategory, error) {
+	keys = append(keys, tagCategory)
+	c, err := TryNewFloat64Counter(name, desc, unit, keys...)
+	return (*Float64CounterWithCategory)(c), err
+}
+
+// newFloat64View registers the metric created by `create` with the measure
+// `name` and its view `viewName`, the metric declared again with the same
+// definition is the registered one.
+func newFloat64View(kind, name, viewName, desc, unit string, agg *view.Aggregation, keys []tag.Key, create func(*stats.Float64Measure, *view.View) interface{}) (interface{}, error) {
+	if unit == "" {
+		unit = stats.UnitDimensionless
+	}
+
+	def := newMetricDefinition(kind, desc, unit, aggregationName(agg), keys)
+	return registered.register(viewName, def, func() (interface{}, error) {
+		fMeasure := stats.Float64(name, desc, unit)
+		fView := &view.View{
+			Name:        viewName,
+			Measure:     fMeasure,
+			Description: desc,
+			Aggregation: agg,
+			TagKeys:     keys,
+		}
+		if err := view.Register(fView); err != nil {
+			return nil, err
+		}
+		return create(fMeasure, fView), nil
+	})
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFloat64CounterName(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{name: "float64_counter_sent", want: "float64_counter_sent_total"},
+		{name: "float64_counter_bytes_total", want: "float64_counter_bytes_total"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			counter, err := TryNewFloat64Counter(c.name, "d", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counter.view.Name != c.want {
+				t.Errorf("expect view %s, got %s", c.want, counter.view.Name)
+			}
+			if counter.measureCt.Name() != c.want {
+				t.Errorf("expect measure %s, got %s", c.want, counter.measureCt.Name())
+			}
+		})
+	}
+}
+
+func TestFloat64CounterAdd(t *testing.T) {
+	ctx := context.Background()
+	counter, err := TryNewFloat64Counter("float64_counter_add", "d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := viewSum(t, "float64_counter_add_total")
+
+	for _, n := range []float64{0.5, 1.25} {
+		if err := counter.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := counter.Add(ctx, -0.5); err == nil {
+		t.Error("expect the negative amount to be rejected")
+	}
+
+	if got := viewSum(t, "float64_counter_add_total") - before; got != 1.75 {
+		t.Errorf("expect the counter to be increased by 1.75, got %v", got)
+	}
+}
+
+// the measure of the counter is not shared with the gauge of `name`
+func TestFloat64CounterAndGaugeOfSameName(t *testing.T) {
+	ctx := context.Background()
+	gauge, err := TryNewFloat64("float64_counter_shared", "d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err := TryNewFloat64Counter("float64_counter_shared", "d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := viewSum(t, "float64_counter_shared_total")
+
+	gauge.Set(ctx, 100)
+	if err := counter.Add(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := viewSum(t, "float64_counter_shared_total") - before; got != 1 {
+		t.Errorf("expect the counter to be increased by 1, got %v", got)
+	}
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/fx"
+)
+
+// MetricsModule starts the exporters configured by the *MetricsConfig when the
+// app starts, and shuts them down when it stops. The *MetricsHandle is provided.
+var MetricsModule = fx.Module("metrics",
+	fx.Provide(newFxMetricsHandle),
+	fx.Invoke(func(*MetricsHandle) {}),
+)
+
+func newFxMetricsHandle(lc fx.Lifecycle, cfg *MetricsConfig) *MetricsHandle {
+	h := newMetricsHandle()
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if err := cfg.Validate(); err != nil {
+				return fmt.Errorf("invalid metrics config: %w", err)
+			}
+			return h.startAll(ctx, cfg)
+		},
+		OnStop: func(ctx context.Context) error {
+			return h.Shutdown(ctx)
+		},
+	})
+	return h
+}
+
+// TracingModule setups tracing with the *TraceConfig when the app starts, and
+// flushes the spans when the app stops. The *tracesdk.TracerProvider is provided,
+// it is nil if tracing is not enabled, and it does not sample or export spans
+// until the app starts.
+func TracingModule(serviceName string) fx.Option {
+	return fx.Module("tracing",
+		fx.Provide(func(lc fx.Lifecycle, cfg *TraceConfig) (*tracesdk.TracerProvider, error) {
+			if !cfg.TracingEnabled && !cfg.JaegerTracingEnabled {
+				return nil, nil
+			}
+
+			tp, err := newTracerProvider(serviceName, cfg)
+			if err != nil {
+				return nil, err
+			}
+			lc.Append(fx.Hook{
+				OnStart: func(ctx context.Context) error {
+					return startTracing(ctx, tp, cfg)
+				},
+				OnStop: func(ctx context.Context) error {
+					return ShutdownTracing(ctx, tp)
+				},
+			})
+			return tp, nil
+		}),
+		fx.Invoke(func(*tracesdk.TracerProvider) {}),
+	)
+}
+
+// Module wires both metrics and tracing with the given configs, e.g.
+//
+//	fx.New(metrics.Module("venus", cfg.Metrics, cfg.Tracing), ...)
+func Module(serviceName string, metricsCfg *MetricsConfig, traceCfg *TraceConfig) fx.Option {
+	return fx.Options(
+		fx.Supply(metricsCfg, traceCfg),
+		MetricsModule,
+		TracingModule(serviceName),
+	)
+}
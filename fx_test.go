@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/fx"
+)
+
+func TestMetricsModuleInvalidConfig(t *testing.T) {
+	cfg := DefaultMetricsConfig()
+	cfg.Enabled = true
+	cfg.Exporter.Types = []ExporterType{ETPrometheus}
+	cfg.Exporter.Prometheus.Path = "metrics"
+
+	app := fx.New(fx.Supply(cfg), MetricsModule, fx.NopLogger)
+	err := app.Start(context.Background())
+	if err == nil {
+		_ = app.Stop(context.Background())
+		t.Fatal("expect the error of the invalid config")
+	}
+	if !strings.Contains(err.Error(), "invalid metrics config") {
+		t.Errorf("expect the validation error, got %s", err)
+	}
+}
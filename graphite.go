@@ -0,0 +1,400 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricexport"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+var (
+	graphiteDroppedPoints  = stats.Int64("graphite_dropped_points", "number of points dropped by the graphite exporter", stats.UnitDimensionless)
+	graphiteBufferedPoints = stats.Int64("graphite_buffered_points", "number of points waiting to be sent to graphite", stats.UnitDimensionless)
+)
+
+var graphiteViews = []*view.View{
+	{
+		Name:        graphiteDroppedPoints.Name(),
+		Measure:     graphiteDroppedPoints,
+		Description: graphiteDroppedPoints.Description(),
+		Aggregation: view.Sum(),
+	},
+	{
+		Name:        graphiteBufferedPoints.Name(),
+		Measure:     graphiteBufferedPoints,
+		Description: graphiteBufferedPoints.Description(),
+		Aggregation: view.LastValue(),
+	},
+}
+
+// graphitePickleBatchSize is the max number of points in one pickle message
+const graphitePickleBatchSize = 500
+
+func RegisterGraphiteExporter(ctx context.Context, cfg *MetricsGraphiteExporterConfig) error {
+	e, err := newGraphiteExporter(cfg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Info("context done")
+
+		if err := e.Shutdown(context.TODO()); err != nil {
+			log.Errorf("shutting down graphite exporter failed: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+type graphitePoint struct {
+	path      string
+	value     float64
+	timestamp int64
+}
+
+// graphiteExporter sends the views to carbon every reporting period, the points
+// are kept in a bounded buffer while carbon is unavailable, and the connection is
+// re-established with exponential backoff.
+type graphiteExporter struct {
+	network   string
+	address   string
+	pickle    bool
+	namespace string
+	tagged    bool
+
+	reader *metricexport.IntervalReader
+
+	mux        sync.Mutex
+	conn       net.Conn
+	buffer     []graphitePoint
+	bufferSize int
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	backoff    time.Duration
+	nextDial   time.Time
+}
+
+func newGraphiteExporter(cfg *MetricsGraphiteExporterConfig) (*graphiteExporter, error) {
+	cfg = cfg.withDefaults()
+	minBackoff, err := time.ParseDuration(cfg.ReconnectBackoff)
+	if err != nil {
+		return nil, err
+	}
+	maxBackoff, err := time.ParseDuration(cfg.MaxReconnectBackoff)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &graphiteExporter{
+		network:    "tcp",
+		address:    net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		namespace:  cfg.Namespace,
+		tagged:     cfg.Tagged,
+		bufferSize: cfg.BufferSize,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}
+	switch cfg.Protocol {
+	case "tcp", "":
+	case "udp":
+		e.network = "udp"
+	case "pickle":
+		e.pickle = true
+	default:
+		return nil, fmt.Errorf("unsupported graphite protocol: %s", cfg.Protocol)
+	}
+
+	if err := view.Register(graphiteViews...); err != nil {
+		return nil, err
+	}
+
+	e.reader, err = startIntervalReader(e, cfg.ReportingPeriod)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Start graphite exporter, send to %s://%s", cfg.Protocol, e.address)
+	return e, nil
+}
+
+// withDefaults returns a copy of the config whose zero buffer size and empty
+// backoffs are replaced by the defaults, so they can be left out of the config.
+func (c *MetricsGraphiteExporterConfig) withDefaults() *MetricsGraphiteExporterConfig {
+	def := newMetricsGraphiteExporterConfig()
+	cfg := *c
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = def.BufferSize
+	}
+	if cfg.ReconnectBackoff == "" {
+		cfg.ReconnectBackoff = def.ReconnectBackoff
+	}
+	if cfg.MaxReconnectBackoff == "" {
+		cfg.MaxReconnectBackoff = def.MaxReconnectBackoff
+	}
+	return &cfg
+}
+
+// Shutdown sends the metrics for the last time, the points still buffered are dropped
+func (e *graphiteExporter) Shutdown(_ context.Context) error {
+	e.reader.Stop()
+	e.reader.Flush()
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if len(e.buffer) > 0 {
+		log.Warnf("drop %d graphite points on shutdown", len(e.buffer))
+	}
+	if e.conn != nil {
+		return e.conn.Close()
+	}
+	return nil
+}
+
+// ExportMetrics implements metricexport.Exporter
+func (e *graphiteExporter) ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	for _, m := range metrics {
+		for _, ts := range m.TimeSeries {
+			for _, p := range ts.Points {
+				e.buffer = append(e.buffer, e.toPoints(m.Descriptor, ts.LabelValues, p)...)
+			}
+		}
+	}
+	if dropped := len(e.buffer) - e.bufferSize; dropped > 0 {
+		// drop the oldest points
+		e.buffer = append(e.buffer[:0], e.buffer[dropped:]...)
+		stats.Record(ctx, graphiteDroppedPoints.M(int64(dropped)))
+		log.Warnf("graphite buffer is full, drop %d points", dropped)
+	}
+
+	err := e.send()
+	stats.Record(ctx, graphiteBufferedPoints.M(int64(len(e.buffer))))
+	return err
+}
+
+// send sends the buffered points, the points not sent are kept in the buffer
+func (e *graphiteExporter) send() error {
+	if e.conn == nil {
+		if time.Now().Before(e.nextDial) {
+			return nil
+		}
+		conn, err := net.DialTimeout(e.network, e.address, 10*time.Second)
+		if err != nil {
+			e.retryLater(err)
+			return err
+		}
+		e.conn = conn
+	}
+
+	var sent int
+	var err error
+	if e.pickle {
+		sent, err = e.sendPickle()
+	} else {
+		sent, err = e.sendPlaintext()
+	}
+	e.buffer = append(e.buffer[:0], e.buffer[sent:]...)
+	if err != nil {
+		_ = e.conn.Close()
+		e.conn = nil
+		e.retryLater(err)
+		return err
+	}
+
+	e.backoff = 0
+	return nil
+}
+
+func (e *graphiteExporter) retryLater(err error) {
+	if e.backoff == 0 {
+		e.backoff = e.minBackoff
+	} else if e.backoff *= 2; e.backoff > e.maxBackoff {
+		e.backoff = e.maxBackoff
+	}
+	e.nextDial = time.Now().Add(e.backoff)
+	log.Warnf("send to graphite %s failed, reconnect in %s: %s", e.address, e.backoff, err)
+}
+
+func (e *graphiteExporter) sendPlaintext() (int, error) {
+	if e.network == "udp" {
+		// udp sends every point in its own datagram, so a lost packet only loses one point
+		for i, p := range e.buffer {
+			if _, err := fmt.Fprintf(e.conn, "%s %s %d\n", p.path, formatGraphiteValue(p.value), p.timestamp); err != nil {
+				return i, err
+			}
+		}
+		return len(e.buffer), nil
+	}
+
+	w := bufio.NewWriter(e.conn)
+	for _, p := range e.buffer {
+		if _, err := fmt.Fprintf(w, "%s %s %d\n", p.path, formatGraphiteValue(p.value), p.timestamp); err != nil {
+			return 0, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return len(e.buffer), nil
+}
+
+func (e *graphiteExporter) sendPickle() (int, error) {
+	for sent := 0; sent < len(e.buffer); {
+		end := sent + graphitePickleBatchSize
+		if end > len(e.buffer) {
+			end = len(e.buffer)
+		}
+		payload := encodeGraphitePickle(e.buffer[sent:end])
+
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(len(payload)))
+		if _, err := e.conn.Write(append(header, payload...)); err != nil {
+			return sent, err
+		}
+		sent = end
+	}
+	return len(e.buffer), nil
+}
+
+// encodeGraphitePickle encodes the points as the pickled list of
+// `(path, (timestamp, value))` tuples carbon expects, in pickle protocol 2.
+func encodeGraphitePickle(points []graphitePoint) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x80, 0x02}) // PROTO 2
+	buf.WriteByte(']')            // EMPTY_LIST
+	buf.WriteByte('(')            // MARK
+	for _, p := range points {
+		buf.WriteByte('X') // BINUNICODE
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(p.path)))
+		buf.WriteString(p.path)
+		buf.WriteByte('G') // BINFLOAT
+		_ = binary.Write(&buf, binary.BigEndian, math.Float64bits(float64(p.timestamp)))
+		buf.WriteByte('G') // BINFLOAT
+		_ = binary.Write(&buf, binary.BigEndian, math.Float64bits(p.value))
+		buf.WriteByte(0x86) // TUPLE2 (timestamp, value)
+		buf.WriteByte(0x86) // TUPLE2 (path, (timestamp, value))
+	}
+	buf.WriteByte('e') // APPENDS
+	buf.WriteByte('.') // STOP
+	return buf.Bytes()
+}
+
+func (e *graphiteExporter) toPoints(desc metricdata.Descriptor, values []metricdata.LabelValue, p metricdata.Point) []graphitePoint {
+	timestamp := p.Time.Unix()
+	point := func(suffix string, extraTags string, value float64) graphitePoint {
+		return graphitePoint{
+			path:      e.path(desc, values, suffix, extraTags),
+			value:     value,
+			timestamp: timestamp,
+		}
+	}
+
+	switch v := p.Value.(type) {
+	case int64:
+		return []graphitePoint{point("", "", float64(v))}
+	case float64:
+		return []graphitePoint{point("", "", v)}
+	case *metricdata.Distribution:
+		points := []graphitePoint{
+			point("count", "", float64(v.Count)),
+			point("sum", "", v.Sum),
+		}
+		// graphite does not support histogram, the cumulative counts of the
+		// buckets are sent like prometheus
+		var bounds []float64
+		if v.BucketOptions != nil {
+			bounds = v.BucketOptions.Bounds
+		}
+		var cum int64
+		for i, b := range v.Buckets {
+			cum += b.Count
+			le := "+Inf"
+			if i < len(bounds) {
+				le = strconv.FormatFloat(bounds[i], 'f', -1, 64)
+			}
+			if e.tagged {
+				points = append(points, point("bucket", ";le="+le, float64(cum)))
+			} else {
+				points = append(points, point("bucket.le_"+sanitizeGraphite(le), "", float64(cum)))
+			}
+		}
+		return points
+	case *metricdata.Summary:
+		points := []graphitePoint{
+			point("count", "", float64(v.Count)),
+			point("sum", "", v.Sum),
+		}
+		// the min, max and quantiles of the window are sent as `name.p99`
+		for _, p := range sortedPercentiles(v.Snapshot.Percentiles) {
+			points = append(points, point(percentileName(p), "", v.Snapshot.Percentiles[p]))
+		}
+		return points
+	default:
+		return nil
+	}
+}
+
+// path builds the graphite path `namespace.name.suffix`, the tags are appended as
+// `;tag=value` if tagged, otherwise the tag values are appended to the path.
+func (e *graphiteExporter) path(desc metricdata.Descriptor, values []metricdata.LabelValue, suffix string, extraTags string) string {
+	var names []string
+	if e.namespace != "" {
+		names = append(names, sanitizeGraphite(e.namespace))
+	}
+	names = append(names, sanitizeGraphite(desc.Name))
+
+	var tags strings.Builder
+	var tagValues []string
+	for i, lv := range values {
+		if !lv.Present || lv.Value == "" || i >= len(desc.LabelKeys) {
+			continue
+		}
+		if e.tagged {
+			tags.WriteString(";" + sanitizeGraphite(desc.LabelKeys[i].Key) + "=" + graphiteTagValueReplacer.Replace(lv.Value))
+		} else {
+			tagValues = append(tagValues, sanitizeGraphite(lv.Value))
+		}
+	}
+
+	if suffix != "" {
+		names = append(names, suffix)
+	}
+	names = append(names, tagValues...)
+	return strings.Join(names, ".") + tags.String() + extraTags
+}
+
+func formatGraphiteValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+var graphiteTagValueReplacer = strings.NewReplacer(";", "_", "~", "_", " ", "_", "\n", "_")
+
+// sanitizeGraphite replaces the characters other than letters, digits, `-` and
+// `_` with underscores.
+func sanitizeGraphite(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+func TestGraphiteToPoints(t *testing.T) {
+	desc := metricdata.Descriptor{
+		Name:      "sector/seal",
+		LabelKeys: []metricdata.LabelKey{{Key: "miner"}, {Key: "stage"}},
+	}
+	values := []metricdata.LabelValue{metricdata.NewLabelValue("f01000"), metricdata.NewLabelValue("pre commit")}
+	dist := &metricdata.Distribution{
+		Count:         3,
+		Sum:           12,
+		BucketOptions: &metricdata.BucketOptions{Bounds: []float64{1, 5}},
+		Buckets:       []metricdata.Bucket{{Count: 1}, {Count: 0}, {Count: 2}},
+	}
+	summary := &metricdata.Summary{
+		Count:    4,
+		Sum:      10,
+		Snapshot: metricdata.Snapshot{Percentiles: map[float64]float64{0: 1, 50: 2, 100: 4}},
+	}
+
+	cases := []struct {
+		name      string
+		namespace string
+		tagged    bool
+		values    []metricdata.LabelValue
+		value     interface{}
+		want      map[string]float64
+	}{
+		{
+			name:   "untagged int64",
+			values: values,
+			value:  int64(7),
+			want:   map[string]float64{"sector_seal.f01000.pre_commit": 7},
+		},
+		{
+			name:   "tagged float64",
+			tagged: true,
+			values: values,
+			value:  1.5,
+			want:   map[string]float64{"sector_seal;miner=f01000;stage=pre_commit": 1.5},
+		},
+		{
+			name:      "namespace and missing tag",
+			namespace: "venus",
+			values:    []metricdata.LabelValue{metricdata.NewLabelValue("f01000"), {}},
+			value:     int64(1),
+			want:      map[string]float64{"venus.sector_seal.f01000": 1},
+		},
+		{
+			name:  "untagged distribution",
+			value: dist,
+			want: map[string]float64{
+				"sector_seal.count":          3,
+				"sector_seal.sum":            12,
+				"sector_seal.bucket.le_1":    1,
+				"sector_seal.bucket.le_5":    1,
+				"sector_seal.bucket.le__Inf": 3,
+			},
+		},
+		{
+			name:   "tagged distribution",
+			tagged: true,
+			value:  dist,
+			want: map[string]float64{
+				"sector_seal.count":          3,
+				"sector_seal.sum":            12,
+				"sector_seal.bucket;le=1":    1,
+				"sector_seal.bucket;le=5":    1,
+				"sector_seal.bucket;le=+Inf": 3,
+			},
+		},
+		{
+			name:  "summary",
+			value: summary,
+			want: map[string]float64{
+				"sector_seal.count": 4,
+				"sector_seal.sum":   10,
+				"sector_seal.min":   1,
+				"sector_seal.p50":   2,
+				"sector_seal.max":   4,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := &graphiteExporter{namespace: c.namespace, tagged: c.tagged}
+			var p metricdata.Point
+			switch v := c.value.(type) {
+			case int64:
+				p = metricdata.NewInt64Point(testTime, v)
+			case float64:
+				p = metricdata.NewFloat64Point(testTime, v)
+			case *metricdata.Distribution:
+				p = metricdata.NewDistributionPoint(testTime, v)
+			case *metricdata.Summary:
+				p = metricdata.NewSummaryPoint(testTime, v)
+			}
+
+			got := make(map[string]float64)
+			for _, point := range e.toPoints(desc, c.values, p) {
+				if point.timestamp != testTime.Unix() {
+					t.Errorf("unexpected timestamp %d of %s", point.timestamp, point.path)
+				}
+				got[point.path] = point.value
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expect %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestGraphitePlaintext(t *testing.T) {
+	points := []graphitePoint{
+		{path: "a.b", value: 1.5, timestamp: 1700000000},
+		{path: "a.c;miner=f01000", value: 100, timestamp: 1700000001},
+	}
+	want := "a.b 1.5 1700000000\na.c;miner=f01000 100 1700000001\n"
+
+	for _, network := range []string{"tcp", "udp"} {
+		t.Run(network, func(t *testing.T) {
+			client, server := net.Pipe()
+			received := make(chan string, 1)
+			go func() {
+				b, _ := io.ReadAll(server)
+				received <- string(b)
+			}()
+
+			e := &graphiteExporter{network: network, conn: client, buffer: points}
+			sent, err := e.sendPlaintext()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sent != len(points) {
+				t.Errorf("expect %d points sent, got %d", len(points), sent)
+			}
+			_ = client.Close()
+			if got := <-received; got != want {
+				t.Errorf("expect %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestGraphitePickle(t *testing.T) {
+	cases := []struct {
+		name   string
+		points []graphitePoint
+		want   string
+	}{
+		{
+			name: "empty",
+			want: "\x80\x02](e.",
+		},
+		{
+			name:   "one point",
+			points: []graphitePoint{{path: "a.b", value: 2.5, timestamp: 1}},
+			want: "\x80\x02](" +
+				"X\x03\x00\x00\x00a.b" +
+				"G\x3f\xf0\x00\x00\x00\x00\x00\x00" +
+				"G\x40\x04\x00\x00\x00\x00\x00\x00" +
+				"\x86\x86" +
+				"e.",
+		},
+		{
+			name: "two points",
+			points: []graphitePoint{
+				{path: "x", value: 1, timestamp: 2},
+				{path: "yz", value: -2, timestamp: 0},
+			},
+			want: "\x80\x02](" +
+				"X\x01\x00\x00\x00x" +
+				"G\x40\x00\x00\x00\x00\x00\x00\x00" +
+				"G\x3f\xf0\x00\x00\x00\x00\x00\x00" +
+				"\x86\x86" +
+				"X\x02\x00\x00\x00yz" +
+				"G\x00\x00\x00\x00\x00\x00\x00\x00" +
+				"G\xc0\x00\x00\x00\x00\x00\x00\x00" +
+				"\x86\x86" +
+				"e.",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := encodeGraphitePickle(c.points); string(got) != c.want {
+				t.Errorf("expect %q, got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestGraphiteSendPickle(t *testing.T) {
+	points := []graphitePoint{{path: "a.b", value: 2.5, timestamp: 1}}
+	client, server := net.Pipe()
+	received := make(chan []byte, 1)
+	go func() {
+		b, _ := io.ReadAll(server)
+		received <- b
+	}()
+
+	e := &graphiteExporter{pickle: true, conn: client, buffer: points}
+	if _, err := e.sendPickle(); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.Close()
+
+	// each payload is prefixed by its length in big endian
+	got := <-received
+	payload := encodeGraphitePickle(points)
+	if len(got) != 4+len(payload) || binary.BigEndian.Uint32(got) != uint32(len(payload)) || !bytes.Equal(got[4:], payload) {
+		t.Errorf("unexpected pickle message %q", got)
+	}
+}
+
+func TestGraphiteConfigDefaults(t *testing.T) {
+	cfg := newMetricsGraphiteExporterConfig()
+	cfg.BufferSize = 0
+	cfg.ReconnectBackoff = ""
+	cfg.MaxReconnectBackoff = ""
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("the zero values should be the defaults: %s", err)
+	}
+
+	got := cfg.withDefaults()
+	def := newMetricsGraphiteExporterConfig()
+	if got.BufferSize != def.BufferSize || got.ReconnectBackoff != def.ReconnectBackoff || got.MaxReconnectBackoff != def.MaxReconnectBackoff {
+		t.Errorf("expect the defaults, got %+v", got)
+	}
+	if cfg.BufferSize != 0 {
+		t.Errorf("the config should not be changed")
+	}
+}
@@ -0,0 +1,320 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// MetricsHandle controls the lifecycle of the exporters started by SetupMetrics.
+type MetricsHandle struct {
+	ready chan struct{}
+	done  chan struct{}
+	errCh chan error
+
+	// mux protects the running exporters, which are replaced on reload
+	mux       sync.Mutex
+	cfg       *MetricsConfig
+	addr      net.Addr
+	handler   http.Handler
+	exporters []namedExporter
+	shutdown  bool
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+type namedExporter struct {
+	typ ExporterType
+	exporter
+}
+
+func newMetricsHandle() *MetricsHandle {
+	return &MetricsHandle{
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+		errCh: make(chan error, 1),
+	}
+}
+
+// Ready is closed when all the exporters are started.
+func (h *MetricsHandle) Ready() <-chan struct{} {
+	return h.ready
+}
+
+// Addr returns the address the prometheus exporter is bound to, or nil if it is
+// not enabled.
+func (h *MetricsHandle) Addr() net.Addr {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.addr
+}
+
+// Handler serves the metrics and the debug endpoints of the prometheus exporter,
+// so they can be mounted on the application router, e.g. when the endpoint of
+// the exporter is empty. It follows the exporter across reloads, and responds
+// 404 if the prometheus exporter is not running.
+func (h *MetricsHandle) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.mux.Lock()
+		handler := h.handler
+		h.mux.Unlock()
+
+		if handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (h *MetricsHandle) isReady() bool {
+	select {
+	case <-h.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// Err receives the errors of the exporters after they are started, e.g. the
+// prometheus server stops serving unexpectedly.
+func (h *MetricsHandle) Err() <-chan error {
+	return h.errCh
+}
+
+// Shutdown flushes the last reporting period and stops all the exporters in
+// the reverse order they are started. Additional calls return the same result.
+func (h *MetricsHandle) Shutdown(ctx context.Context) error {
+	h.shutdownOnce.Do(func() {
+		defer close(h.done)
+
+		h.mux.Lock()
+		defer h.mux.Unlock()
+		h.shutdown = true
+		h.shutdownErr = stopExporters(ctx, h.exporters)
+		h.setExporters(nil)
+	})
+	return h.shutdownErr
+}
+
+// Reload replaces the running exporters with the ones configured by `cfg`. The
+// new exporters are started before the old ones are flushed and stopped, so no
+// reporting period is lost. The prometheus exporter is the exception, the
+// running one is stopped first, since the new one binds the endpoint and
+// registers the collectors again. The new statsd exporter continues from the
+// counters sent by the old one, so they are not sent again. If the new
+// exporters fail to start, the old ones keep running and the error is returned.
+func (h *MetricsHandle) Reload(ctx context.Context, cfg *MetricsConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid metrics config: %w", err)
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.shutdown {
+		return fmt.Errorf("metrics handle is shut down")
+	}
+
+	old := h.exporters
+	var stoppedPrometheus bool
+	if cfg.Enabled && hasExporterType(cfg.Exporter.EnabledTypes(), ETPrometheus) {
+		old, stoppedPrometheus = h.stopPrometheus(ctx, old)
+	}
+
+	exporters, err := h.newExporters(ctx, cfg)
+	if err != nil {
+		if stoppedPrometheus {
+			e, err := h.newExporter(ctx, ETPrometheus, h.cfg.Exporter)
+			if err != nil {
+				log.Errorf("restoring the previous prometheus exporter failed: %s", err)
+			} else {
+				old = append(old, e)
+			}
+		}
+		h.setExporters(old)
+		return err
+	}
+
+	h.setExporters(exporters)
+	h.cfg = cfg
+	if err := stopExporters(ctx, old); err != nil {
+		log.Warnf("stopping the previous exporters failed: %s", err)
+	}
+	log.Infof("metrics config reloaded, exporters: %v", h.types())
+	return nil
+}
+
+// stopPrometheus stops the running prometheus exporter in `exporters`, and
+// returns the others. The caller must hold h.mux.
+func (h *MetricsHandle) stopPrometheus(ctx context.Context, exporters []namedExporter) ([]namedExporter, bool) {
+	rest := make([]namedExporter, 0, len(exporters))
+	var stopped bool
+	for _, e := range exporters {
+		if e.typ != ETPrometheus {
+			rest = append(rest, e)
+			continue
+		}
+		if err := e.Shutdown(ctx); err != nil {
+			log.Warnf("stopping prometheus exporter for reload failed: %s", err)
+		}
+		stopped = true
+	}
+	h.setExporters(rest)
+	return rest, stopped
+}
+
+// startAll starts all the enabled exporters, if any of them fails to start, the
+// started ones are stopped.
+func (h *MetricsHandle) startAll(ctx context.Context, cfg *MetricsConfig) error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	exporters, err := h.newExporters(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	h.setExporters(exporters)
+	h.cfg = cfg
+	close(h.ready)
+	return nil
+}
+
+// newExporters starts the exporters enabled by `cfg`, the started ones are
+// stopped if any of them fails.
+func (h *MetricsHandle) newExporters(ctx context.Context, cfg *MetricsConfig) ([]namedExporter, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var exporters []namedExporter
+	for _, et := range cfg.Exporter.EnabledTypes() {
+		e, err := h.newExporter(ctx, et, cfg.Exporter)
+		if err != nil {
+			if err := stopExporters(context.TODO(), exporters); err != nil {
+				log.Errorf("shutting down started exporters failed: %s", err)
+			}
+			return nil, fmt.Errorf("failed to register %s exporter: %w", et, err)
+		}
+		exporters = append(exporters, e)
+	}
+	return exporters, nil
+}
+
+// setExporters makes `exporters` the running ones, and exposes the address and
+// the handler of the prometheus exporter among them. The caller must hold h.mux.
+func (h *MetricsHandle) setExporters(exporters []namedExporter) {
+	h.exporters = exporters
+	h.addr = nil
+	h.handler = nil
+	for _, e := range exporters {
+		if pe, ok := e.exporter.(*prometheusExporter); ok {
+			h.addr = pe.addr
+			h.handler = pe.handler
+		}
+	}
+}
+
+// stopExporters stops `exporters` in the reverse order they are started.
+func stopExporters(ctx context.Context, exporters []namedExporter) error {
+	var errs []error
+	for i := len(exporters) - 1; i >= 0; i-- {
+		e := exporters[i]
+		if err := e.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown %s exporter: %w", e.typ, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func hasExporterType(types []ExporterType, et ExporterType) bool {
+	for _, t := range types {
+		if t == et {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *MetricsHandle) types() []ExporterType {
+	types := make([]ExporterType, 0, len(h.exporters))
+	for _, e := range h.exporters {
+		types = append(types, e.typ)
+	}
+	return types
+}
+
+func (h *MetricsHandle) newExporter(ctx context.Context, et ExporterType, cfg *MetricsExporterConfig) (namedExporter, error) {
+	var e exporter
+	switch et {
+	case ETPrometheus:
+		pe, err := newPrometheusExporter(cfg.Prometheus, h.isReady)
+		if err != nil {
+			return namedExporter{}, err
+		}
+		go func() {
+			if err := <-pe.serveErr; err != nil {
+				h.reportErr(fmt.Errorf("prometheus exporter: %w", err))
+			}
+		}()
+		e = pe
+	case ETGraphite:
+		ge, err := newGraphiteExporter(cfg.Graphite)
+		if err != nil {
+			return namedExporter{}, err
+		}
+		e = ge
+	case ETOTLP:
+		oe, err := newOTLPExporter(ctx, cfg.OTLP)
+		if err != nil {
+			return namedExporter{}, err
+		}
+		e = oe
+	case ETPushgateway:
+		pe, err := newPushgatewayExporter(cfg.Pushgateway)
+		if err != nil {
+			return namedExporter{}, err
+		}
+		e = pe
+	case ETStatsd:
+		se, err := newStatsdExporter(cfg.Statsd, h.statsdValues())
+		if err != nil {
+			return namedExporter{}, err
+		}
+		e = se
+	case ETInfluxDB:
+		ie, err := newInfluxDBExporter(cfg.InfluxDB)
+		if err != nil {
+			return namedExporter{}, err
+		}
+		e = ie
+	default:
+		return namedExporter{}, fmt.Errorf("invalid exporter type: %s", et)
+	}
+
+	return namedExporter{typ: et, exporter: e}, nil
+}
+
+// statsdValues returns the values sent by the running statsd exporter, which
+// are handed over to the new one on reload. The caller must hold h.mux.
+func (h *MetricsHandle) statsdValues() *cumulativeValues {
+	for _, e := range h.exporters {
+		if se, ok := e.exporter.(*statsdExporter); ok {
+			return se.sent
+		}
+	}
+	return nil
+}
+
+// reportErr logs `err` and sends it to the error channel, it is dropped if the
+// previous error is not received yet.
+func (h *MetricsHandle) reportErr(err error) {
+	log.Errorf("metrics exporter failed: %s", err)
+	select {
+	case h.errCh <- err:
+	default:
+	}
+}
@@ -0,0 +1,320 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the statsd counters are sent as increments, the exporters started by reloads
+// must not send the values sent by the previous ones again
+func TestReloadStatsdCounters(t *testing.T) {
+	ctx := context.Background()
+	counter, err := TryNewSumCounter("handle_reload_sent", "d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := counter.Add(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	// the first exporter sends the whole value once, which is more than 100 if
+	// the test runs several times
+	want := viewSum(t, "handle_reload_sent_total")
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+
+	cfg := DefaultMetricsConfig()
+	cfg.Enabled = true
+	cfg.Exporter.Types = []ExporterType{ETStatsd}
+	cfg.Exporter.Statsd.Address = conn.LocalAddr().String()
+	// the metrics are only sent when the exporters are stopped
+	cfg.Exporter.Statsd.ReportingPeriod = "1h"
+
+	h, err := SetupMetrics(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := h.Reload(ctx, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent float64
+	buf := make([]byte, 65536)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			value, ok := strings.CutPrefix(line, "handle_reload_sent_total:")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSuffix(value, "|c"), 64)
+			if err != nil {
+				t.Fatalf("invalid line %q: %s", line, err)
+			}
+			sent += v
+		}
+	}
+	if sent != want {
+		t.Errorf("expect the increments to sum to %v, got %v", want, sent)
+	}
+}
+
+func newTestPrometheusConfig() *MetricsConfig {
+	cfg := DefaultMetricsConfig()
+	cfg.Enabled = true
+	cfg.Exporter.Types = []ExporterType{ETPrometheus}
+	cfg.Exporter.Prometheus.EndPoint = "/ip4/127.0.0.1/tcp/0"
+	return cfg
+}
+
+// getStatus requests `url` without keeping the connection, which would delay
+// the shutdown of the server
+func getStatus(t *testing.T, url string) int {
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSetupMetricsHandle(t *testing.T) {
+	ctx := context.Background()
+	h, err := SetupMetrics(ctx, newTestPrometheusConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h.Ready():
+	default:
+		t.Fatal("expect the handle to be ready")
+	}
+	if h.Addr() == nil {
+		t.Fatal("expect the bound address")
+	}
+
+	if code := getStatus(t, "http://"+h.Addr().String()+"/debug/metrics"); code != http.StatusOK {
+		t.Errorf("expect the metrics to be served, got %d", code)
+	}
+	rec := httptest.NewRecorder()
+	h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expect the metrics to be served by the handler, got %d", rec.Code)
+	}
+
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Shutdown(ctx); err != nil {
+		t.Errorf("expect the same result of the first shutdown, got %s", err)
+	}
+	if h.Addr() != nil {
+		t.Error("expect no address after shutdown")
+	}
+	rec = httptest.NewRecorder()
+	h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expect 404 after shutdown, got %d", rec.Code)
+	}
+	select {
+	case err := <-h.Err():
+		t.Errorf("unexpected error %s", err)
+	default:
+	}
+}
+
+// the port conflict fails the setup instead of being logged only
+func TestSetupMetricsListenError(t *testing.T) {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lst.Close() //nolint:errcheck
+
+	cfg := newTestPrometheusConfig()
+	cfg.Exporter.Prometheus.EndPoint = fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", lst.Addr().(*net.TCPAddr).Port)
+	if _, err := SetupMetrics(context.Background(), cfg); err == nil {
+		t.Fatal("expect the error of the bound port")
+	}
+
+	// the collectors registered by the failed exporter are removed
+	cfg.Exporter.Prometheus.EndPoint = "/ip4/127.0.0.1/tcp/0"
+	h, err := SetupMetrics(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = h.Shutdown(context.Background())
+}
+
+func TestMetricsHandleErr(t *testing.T) {
+	h, err := SetupMetrics(context.Background(), newTestPrometheusConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Shutdown(context.Background()) //nolint:errcheck
+
+	// the server stops serving when its listener is closed unexpectedly
+	h.mux.Lock()
+	_ = h.exporters[0].exporter.(*prometheusExporter).lst.Close()
+	h.mux.Unlock()
+
+	select {
+	case err := <-h.Err():
+		if !strings.Contains(err.Error(), "prometheus exporter") {
+			t.Errorf("unexpected error %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect the error of the prometheus server")
+	}
+}
+
+// the exporters are shut down when the context passed to SetupMetrics is done
+func TestSetupMetricsContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := SetupMetrics(ctx, newTestPrometheusConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case <-h.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect the handle to be shut down")
+	}
+	if h.Addr() != nil {
+		t.Error("expect no address after shutdown")
+	}
+}
+
+// freeEndpoint returns the multiaddr of a port which is free for now
+func freeEndpoint(t *testing.T) string {
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lst.Close() //nolint:errcheck
+	return fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", lst.Addr().(*net.TCPAddr).Port)
+}
+
+// the endpoint of the running prometheus exporter is released before the new
+// one binds it
+func TestReloadPrometheusSameEndpoint(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestPrometheusConfig()
+	cfg.Exporter.Prometheus.EndPoint = freeEndpoint(t)
+	h, err := SetupMetrics(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Shutdown(ctx) //nolint:errcheck
+	addr := h.Addr().String()
+
+	reloaded := newTestPrometheusConfig()
+	reloaded.Exporter.Prometheus.EndPoint = cfg.Exporter.Prometheus.EndPoint
+	reloaded.Exporter.Prometheus.Path = "/metrics"
+	if err := h.Reload(ctx, reloaded); err != nil {
+		t.Fatal(err)
+	}
+	if h.Addr().String() != addr {
+		t.Errorf("expect the same address %s, got %s", addr, h.Addr())
+	}
+	if code := getStatus(t, "http://"+addr+"/metrics"); code != http.StatusOK {
+		t.Errorf("expect the new path to be served, got %d", code)
+	}
+	if code := getStatus(t, "http://"+addr+"/debug/metrics"); code != http.StatusNotFound {
+		t.Errorf("expect the old path to be removed, got %d", code)
+	}
+}
+
+// the exporters keep running if the new ones fail to start
+func TestReloadFailureKeepsExporters(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestPrometheusConfig()
+	cfg.Exporter.Prometheus.EndPoint = freeEndpoint(t)
+	h, err := SetupMetrics(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Shutdown(ctx) //nolint:errcheck
+	addr := h.Addr().String()
+
+	lst, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lst.Close() //nolint:errcheck
+	conflict := newTestPrometheusConfig()
+	conflict.Exporter.Prometheus.EndPoint = fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", lst.Addr().(*net.TCPAddr).Port)
+	if err := h.Reload(ctx, conflict); err == nil {
+		t.Fatal("expect the error of the bound port")
+	}
+	if h.Addr() == nil || h.Addr().String() != addr {
+		t.Fatalf("expect the previous exporter at %s, got %v", addr, h.Addr())
+	}
+	if code := getStatus(t, "http://"+addr+"/debug/metrics"); code != http.StatusOK {
+		t.Errorf("expect the previous exporter to be serving, got %d", code)
+	}
+
+	invalid := newTestPrometheusConfig()
+	invalid.Exporter.Types = []ExporterType{"datadog"}
+	if err := h.Reload(ctx, invalid); err == nil {
+		t.Fatal("expect the error of the invalid config")
+	}
+	if h.Addr() == nil || h.Addr().String() != addr {
+		t.Errorf("expect the previous exporter at %s, got %v", addr, h.Addr())
+	}
+}
+
+func TestReloadDisable(t *testing.T) {
+	ctx := context.Background()
+	h, err := SetupMetrics(ctx, newTestPrometheusConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := h.Addr().String()
+
+	if err := h.Reload(ctx, DefaultMetricsConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if h.Addr() != nil {
+		t.Errorf("expect the prometheus exporter to be stopped, got %s", h.Addr())
+	}
+	if _, err := http.Get("http://" + addr + "/debug/metrics"); err == nil {
+		t.Error("expect the endpoint to be closed")
+	}
+
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Reload(ctx, newTestPrometheusConfig()); err == nil {
+		t.Error("expect the error of reloading the shut down handle")
+	}
+}
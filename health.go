@@ -0,0 +1,265 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type HealthStatus string
+
+const (
+	HSOK      HealthStatus = "ok"
+	HSFailing HealthStatus = "failing"
+	// HSUnknown is the status of the checks not run yet
+	HSUnknown HealthStatus = "unknown"
+)
+
+// HealthCheck is a named check of a component.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	// Interval is the period to run the check, the result is cached in between.
+	// Default to 10s.
+	Interval time.Duration
+	// Timeout of each run, the check fails if it does not return in time.
+	// Default to 5s.
+	Timeout time.Duration
+	// Sync runs the check on each probe instead of periodically, it fits the
+	// checks cheap enough and required to be up to date.
+	Sync bool
+	// Critical checks make the service not ready if they fail, the others are
+	// only reported.
+	Critical bool
+}
+
+// HealthResult is the last result of a check
+type HealthResult struct {
+	Status   HealthStatus `json:"status"`
+	Error    string       `json:"error,omitempty"`
+	Critical bool         `json:"critical"`
+	LastRun  time.Time    `json:"lastRun"`
+	Duration string       `json:"duration"`
+}
+
+// HealthReport is the results of all the checks, Status is failing if any
+// critical check is not ok.
+type HealthReport struct {
+	Status HealthStatus            `json:"status"`
+	Checks map[string]HealthResult `json:"checks"`
+}
+
+// DefaultHealthRegistry is served by the health endpoints of the debug server
+var DefaultHealthRegistry = NewHealthRegistry()
+
+// RegisterHealthCheck registers the check to DefaultHealthRegistry
+func RegisterHealthCheck(check HealthCheck) error {
+	return DefaultHealthRegistry.Register(check)
+}
+
+// HealthRegistry runs the registered checks and caches their results, each
+// result is exported by the `health_check_status` gauge with the check name as
+// category, 1 for ok and 0 for failing.
+type HealthRegistry struct {
+	mux    sync.Mutex
+	checks map[string]*healthCheck
+}
+
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{
+		checks: make(map[string]*healthCheck),
+	}
+}
+
+var (
+	healthCheckStatusOnce sync.Once
+	healthCheckStatus     *Int64WithCategory
+)
+
+func healthCheckGauge() *Int64WithCategory {
+	healthCheckStatusOnce.Do(func() {
+		healthCheckStatus = NewInt64WithCategory("health_check_status", "1 if the health check passes, 0 otherwise", "")
+	})
+	return healthCheckStatus
+}
+
+type healthCheck struct {
+	HealthCheck
+
+	stop chan struct{}
+
+	mux     sync.Mutex
+	result  HealthResult
+	running bool
+}
+
+// Register registers the check and starts running it periodically unless it is
+// a sync check.
+func (r *HealthRegistry) Register(check HealthCheck) error {
+	if check.Name == "" || check.Check == nil {
+		return fmt.Errorf("health check must have a name and a check function")
+	}
+	if check.Interval <= 0 {
+		check.Interval = 10 * time.Second
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = 5 * time.Second
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if _, ok := r.checks[check.Name]; ok {
+		return fmt.Errorf("health check %s is already registered", check.Name)
+	}
+	c := &healthCheck{
+		HealthCheck: check,
+		stop:        make(chan struct{}),
+		result:      HealthResult{Status: HSUnknown, Critical: check.Critical},
+	}
+	r.checks[check.Name] = c
+
+	healthCheckGauge()
+	if !check.Sync {
+		go c.loop()
+	}
+	return nil
+}
+
+// Unregister stops and removes the check
+func (r *HealthRegistry) Unregister(name string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if c, ok := r.checks[name]; ok {
+		close(c.stop)
+		delete(r.checks, name)
+	}
+}
+
+// Report returns the results of all the checks, the sync checks are run now.
+func (r *HealthRegistry) Report(ctx context.Context) HealthReport {
+	r.mux.Lock()
+	checks := make([]*healthCheck, 0, len(r.checks))
+	for _, c := range r.checks {
+		checks = append(checks, c)
+	}
+	r.mux.Unlock()
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+	report := HealthReport{
+		Status: HSOK,
+		Checks: make(map[string]HealthResult, len(checks)),
+	}
+	for _, c := range checks {
+		if c.Sync {
+			c.run(ctx)
+		}
+		res := c.lastResult()
+		report.Checks[c.Name] = res
+		if c.Critical && res.Status != HSOK {
+			report.Status = HSFailing
+		}
+	}
+	return report
+}
+
+// ServeHTTP serves the report as json, it responds 503 if any critical check is
+// not ok.
+func (r *HealthRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	writeHealthReport(w, r.Report(req.Context()))
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != HSOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+func (c *healthCheck) loop() {
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	c.run(context.Background())
+	for {
+		select {
+		case <-ticker.C:
+			c.run(context.Background())
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// run runs the check with timeout, the check still running from the last time
+// is not run again, so a hanging check does not pile up goroutines.
+func (c *healthCheck) run(ctx context.Context) {
+	c.mux.Lock()
+	if c.running {
+		c.mux.Unlock()
+		return
+	}
+	c.running = true
+	c.mux.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("panic: %v", p)
+			}
+		}()
+		done <- c.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+		c.mux.Lock()
+		c.running = false
+		c.mux.Unlock()
+	case <-ctx.Done():
+		err = fmt.Errorf("check did not return in %s: %w", c.Timeout, ctx.Err())
+		go func() {
+			// wait for the hanging check before running it again
+			<-done
+			c.mux.Lock()
+			c.running = false
+			c.mux.Unlock()
+		}()
+	}
+	cancel()
+
+	res := HealthResult{
+		Status:   HSOK,
+		Critical: c.Critical,
+		LastRun:  start,
+		Duration: time.Since(start).String(),
+	}
+	var value int64 = 1
+	if err != nil {
+		res.Status = HSFailing
+		res.Error = err.Error()
+		value = 0
+		log.Warnf("health check %s failed: %s", c.Name, err)
+	}
+
+	c.mux.Lock()
+	c.result = res
+	c.mux.Unlock()
+	healthCheckGauge().Set(context.Background(), c.Name, value)
+}
+
+func (c *healthCheck) lastResult() HealthResult {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.result
+}
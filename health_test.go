@@ -0,0 +1,280 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+func newTestHealthRegistry(t *testing.T, checks ...HealthCheck) *HealthRegistry {
+	r := NewHealthRegistry()
+	for _, c := range checks {
+		if err := r.Register(c); err != nil {
+			t.Fatal(err)
+		}
+		name := c.Name
+		t.Cleanup(func() { r.Unregister(name) })
+	}
+	return r
+}
+
+func serveHealth(t *testing.T, h http.Handler) (int, HealthReport) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report HealthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid report %q: %s", rec.Body, err)
+	}
+	return rec.Code, report
+}
+
+// healthGauge returns the value of `health_check_status` exported for the check
+func healthGauge(t *testing.T, name string) float64 {
+	rows, err := view.RetrieveData("health_check_status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		for _, tg := range row.Tags {
+			if tg.Key == tagCategory && tg.Value == name {
+				return row.Data.(*view.LastValueData).Value
+			}
+		}
+	}
+	t.Fatalf("expect the gauge of %s", name)
+	return 0
+}
+
+func TestHealthRegistryReport(t *testing.T) {
+	var syncRuns atomic.Int32
+	var failing atomic.Bool
+	r := newTestHealthRegistry(t,
+		HealthCheck{
+			Name: "health_test_sync",
+			Check: func(ctx context.Context) error {
+				syncRuns.Add(1)
+				if failing.Load() {
+					return errors.New("chain is not synced")
+				}
+				return nil
+			},
+			Sync:     true,
+			Critical: true,
+		},
+		HealthCheck{
+			Name:  "health_test_optional",
+			Check: func(ctx context.Context) error { return errors.New("disk is slow") },
+			Sync:  true,
+		},
+	)
+
+	code, report := serveHealth(t, r)
+	if code != http.StatusOK || report.Status != HSOK {
+		t.Errorf("expect the failing optional check not to fail the report, got %d %+v", code, report)
+	}
+	if res := report.Checks["health_test_optional"]; res.Status != HSFailing || res.Error != "disk is slow" || res.Critical {
+		t.Errorf("unexpected result of the optional check %+v", res)
+	}
+	if v := healthGauge(t, "health_test_optional"); v != 0 {
+		t.Errorf("expect the gauge of the failing check to be 0, got %v", v)
+	}
+	if v := healthGauge(t, "health_test_sync"); v != 1 {
+		t.Errorf("expect the gauge of the passing check to be 1, got %v", v)
+	}
+
+	failing.Store(true)
+	code, report = serveHealth(t, r)
+	if code != http.StatusServiceUnavailable || report.Status != HSFailing {
+		t.Errorf("expect the failing critical check to fail the report, got %d %+v", code, report)
+	}
+	if res := report.Checks["health_test_sync"]; res.Status != HSFailing || !res.Critical {
+		t.Errorf("unexpected result of the critical check %+v", res)
+	}
+	if v := healthGauge(t, "health_test_sync"); v != 0 {
+		t.Errorf("expect the gauge of the failing check to be 0, got %v", v)
+	}
+	// the sync checks run on each report
+	if n := syncRuns.Load(); n != 2 {
+		t.Errorf("expect 2 runs of the sync check, got %d", n)
+	}
+}
+
+func TestHealthCheckPeriodic(t *testing.T) {
+	var runs atomic.Int32
+	r := newTestHealthRegistry(t, HealthCheck{
+		Name: "health_test_periodic",
+		Check: func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		},
+		Interval: 20 * time.Millisecond,
+		Critical: true,
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runs.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the check to run periodically, got %d runs", runs.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if report := r.Report(context.Background()); report.Status != HSOK {
+		t.Errorf("expect ok, got %+v", report)
+	}
+
+	// the check is stopped once unregistered
+	r.Unregister("health_test_periodic")
+	n := runs.Load()
+	time.Sleep(100 * time.Millisecond)
+	if got := runs.Load(); got > n+1 {
+		t.Errorf("expect the check to stop, got %d runs after %d", got, n)
+	}
+	if report := r.Report(context.Background()); len(report.Checks) != 0 {
+		t.Errorf("expect no checks, got %+v", report.Checks)
+	}
+}
+
+// the results of the periodic checks are cached until they run
+func TestHealthCheckUnknown(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	r := newTestHealthRegistry(t, HealthCheck{
+		Name: "health_test_unknown",
+		Check: func(ctx context.Context) error {
+			<-release
+			return nil
+		},
+		Interval: time.Hour,
+		Timeout:  time.Hour,
+		Critical: true,
+	})
+
+	code, report := serveHealth(t, r)
+	if code != http.StatusServiceUnavailable || report.Checks["health_test_unknown"].Status != HSUnknown {
+		t.Errorf("expect the critical check not run yet to fail the report, got %d %+v", code, report)
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	r := newTestHealthRegistry(t, HealthCheck{
+		Name: "health_test_timeout",
+		// the check ignores the context
+		Check: func(ctx context.Context) error {
+			runs.Add(1)
+			<-release
+			return nil
+		},
+		Timeout:  20 * time.Millisecond,
+		Sync:     true,
+		Critical: true,
+	})
+
+	report := r.Report(context.Background())
+	res := report.Checks["health_test_timeout"]
+	if res.Status != HSFailing || !strings.Contains(res.Error, "did not return in 20ms") {
+		t.Errorf("expect the timeout, got %+v", res)
+	}
+	// the hanging check is not run again
+	r.Report(context.Background())
+	if n := runs.Load(); n != 1 {
+		t.Errorf("expect 1 run of the hanging check, got %d", n)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Report(context.Background()).Status != HSOK {
+		if time.Now().After(deadline) {
+			t.Fatal("expect the check to run again once it returns")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHealthCheckPanic(t *testing.T) {
+	r := newTestHealthRegistry(t, HealthCheck{
+		Name:  "health_test_panic",
+		Check: func(ctx context.Context) error { panic("nil pointer") },
+		Sync:  true,
+	})
+
+	res := r.Report(context.Background()).Checks["health_test_panic"]
+	if res.Status != HSFailing || res.Error != "panic: nil pointer" {
+		t.Errorf("expect the panic to fail the check, got %+v", res)
+	}
+}
+
+func TestHealthRegistryRegister(t *testing.T) {
+	check := func(ctx context.Context) error { return nil }
+	r := newTestHealthRegistry(t, HealthCheck{Name: "health_test_register", Check: check, Sync: true})
+
+	if err := r.Register(HealthCheck{Name: "health_test_register", Check: check}); err == nil {
+		t.Error("expect the error of the duplicated name")
+	}
+	if err := r.Register(HealthCheck{Check: check}); err == nil {
+		t.Error("expect the error of the missing name")
+	}
+	if err := r.Register(HealthCheck{Name: "health_test_no_check"}); err == nil {
+		t.Error("expect the error of the missing check")
+	}
+}
+
+// the health endpoints are served without auth, and /readyz fails until the
+// exporters are started
+func TestHealthHandlers(t *testing.T) {
+	if err := RegisterHealthCheck(HealthCheck{
+		Name:  "health_test_default",
+		Check: func(ctx context.Context) error { return nil },
+		Sync:  true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultHealthRegistry.Unregister("health_test_default")
+
+	cfg := newMetricsPrometheusExporterConfig()
+	cfg.EndPoint = ""
+	cfg.BearerToken = "token"
+	cfg.Debug.Health = true
+	var ready atomic.Bool
+	e, err := newPrometheusExporter(cfg, ready.Load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Shutdown(context.Background()) //nolint:errcheck
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("expect /healthz to be open, got %d", rec.Code)
+	}
+	if rec := get("/debug/metrics"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expect the metrics to require auth, got %d", rec.Code)
+	}
+
+	code, report := serveHealth(t, e.handler)
+	if code != http.StatusServiceUnavailable || report.Checks["metrics"].Status != HSFailing {
+		t.Errorf("expect not ready before the exporters are started, got %d %+v", code, report)
+	}
+
+	ready.Store(true)
+	code, report = serveHealth(t, e.handler)
+	if code != http.StatusOK || report.Checks["health_test_default"].Status != HSOK {
+		t.Errorf("expect ready, got %d %+v", code, report)
+	}
+	if _, ok := report.Checks["metrics"]; ok {
+		t.Error("expect no metrics check once ready")
+	}
+}
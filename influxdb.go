@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricexport"
+)
+
+// RegisterInfluxDBExporter register the influxdb exporter, the views are written
+// to influxdb in line protocol every reporting period, through the v2 http write
+// api or raw udp.
+func RegisterInfluxDBExporter(ctx context.Context, cfg *MetricsInfluxDBExporterConfig) error {
+	e, err := newInfluxDBExporter(cfg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Info("context done")
+
+		if err := e.Shutdown(context.TODO()); err != nil {
+			log.Errorf("shutting down influxdb exporter failed: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+type influxDBExporter struct {
+	namespace string
+	write     func(ctx context.Context, lines []string) error
+
+	maxRetries   int
+	retryBackoff time.Duration
+
+	reader *metricexport.IntervalReader
+	// closed on shutdown to stop retrying
+	stop  chan struct{}
+	close func() error
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+func newInfluxDBExporter(cfg *MetricsInfluxDBExporterConfig) (*influxDBExporter, error) {
+	retryBackoff, err := time.ParseDuration(cfg.RetryBackoff)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &influxDBExporter{
+		namespace:    cfg.Namespace,
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: retryBackoff,
+		stop:         make(chan struct{}),
+		close:        func() error { return nil },
+	}
+
+	switch cfg.Protocol {
+	case "http":
+		writeURL, err := influxDBWriteURL(cfg)
+		if err != nil {
+			return nil, err
+		}
+		client := &http.Client{Timeout: 10 * time.Second}
+		e.write = func(ctx context.Context, lines []string) error {
+			return writeInfluxDBHTTP(ctx, client, writeURL, cfg.Token, lines)
+		}
+	case "udp":
+		conn, err := net.Dial("udp", cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("could not dial influxdb: %w", err)
+		}
+		e.write = func(_ context.Context, lines []string) error {
+			for _, packet := range packLines(lines, cfg.MaxPacketSize) {
+				if _, err := conn.Write(packet); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		e.close = conn.Close
+	default:
+		return nil, fmt.Errorf("unsupported influxdb protocol: %s", cfg.Protocol)
+	}
+
+	e.reader, err = startIntervalReader(e, cfg.ReportingPeriod)
+	if err != nil {
+		_ = e.close()
+		return nil, err
+	}
+
+	log.Infof("Start influxdb exporter over %s", cfg.Protocol)
+	return e, nil
+}
+
+func influxDBWriteURL(cfg *MetricsInfluxDBExporterConfig) (string, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid influxdb url: %w", err)
+	}
+	u = u.JoinPath("/api/v2/write")
+	u.RawQuery = url.Values{
+		"org":       []string{cfg.Org},
+		"bucket":    []string{cfg.Bucket},
+		"precision": []string{"ns"},
+	}.Encode()
+	return u.String(), nil
+}
+
+func writeInfluxDBHTTP(ctx context.Context, client *http.Client, writeURL, token string, lines []string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, writeURL, strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// Shutdown writes the metrics for the last time, the pending retries are given
+// up, and the calls after the first one return the same error.
+func (e *influxDBExporter) Shutdown(_ context.Context) error {
+	e.shutdownOnce.Do(func() {
+		close(e.stop)
+		e.reader.Stop()
+		e.reader.Flush()
+		e.shutdownErr = e.close()
+	})
+	return e.shutdownErr
+}
+
+// ExportMetrics implements metricexport.Exporter, the failed writes are retried
+// with exponential backoff.
+func (e *influxDBExporter) ExportMetrics(ctx context.Context, metrics []*metricdata.Metric) error {
+	var lines []string
+	for _, m := range metrics {
+		for _, ts := range m.TimeSeries {
+			for _, p := range ts.Points {
+				if line := e.toLine(m.Descriptor, ts.LabelValues, p); line != "" {
+					lines = append(lines, line)
+				}
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	backoff, maxRetries := e.retryBackoff, e.maxRetries
+	for i := 0; ; i++ {
+		err := e.write(ctx, lines)
+		if err == nil {
+			return nil
+		}
+		if i >= maxRetries {
+			log.Warnf("write %d lines to influxdb failed: %s", len(lines), err)
+			return err
+		}
+
+		log.Debugf("write to influxdb failed, retry in %s: %s", backoff, err)
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-e.stop:
+			// try once more without waiting on shutdown
+			maxRetries = i + 1
+		}
+	}
+}
+
+// toLine returns the point in line protocol, or empty if the type of the point
+// is not supported.
+func (e *influxDBExporter) toLine(desc metricdata.Descriptor, values []metricdata.LabelValue, p metricdata.Point) string {
+	var b strings.Builder
+
+	name := desc.Name
+	if e.namespace != "" {
+		name = e.namespace + "_" + name
+	}
+	b.WriteString(influxMeasurementEscaper.Replace(name))
+	for i, lv := range values {
+		if !lv.Present || lv.Value == "" || i >= len(desc.LabelKeys) {
+			continue
+		}
+		b.WriteString(",")
+		b.WriteString(influxTagEscaper.Replace(desc.LabelKeys[i].Key))
+		b.WriteString("=")
+		b.WriteString(influxTagEscaper.Replace(lv.Value))
+	}
+
+	b.WriteString(" ")
+	switch v := p.Value.(type) {
+	case int64:
+		b.WriteString("value=" + strconv.FormatInt(v, 10) + "i")
+	case float64:
+		b.WriteString("value=" + strconv.FormatFloat(v, 'f', -1, 64))
+	case *metricdata.Distribution:
+		b.WriteString("count=" + strconv.FormatInt(v.Count, 10) + "i")
+		b.WriteString(",sum=" + strconv.FormatFloat(v.Sum, 'f', -1, 64))
+		// the buckets are written as cumulative counts like prometheus
+		var cum int64
+		var bounds []float64
+		if v.BucketOptions != nil {
+			bounds = v.BucketOptions.Bounds
+		}
+		for i, bucket := range v.Buckets {
+			cum += bucket.Count
+			le := "inf"
+			if i < len(bounds) {
+				le = strconv.FormatFloat(bounds[i], 'f', -1, 64)
+			}
+			b.WriteString(",le_" + influxTagEscaper.Replace(le) + "=" + strconv.FormatInt(cum, 10) + "i")
+		}
+	case *metricdata.Summary:
+		b.WriteString("count=" + strconv.FormatInt(v.Count, 10) + "i")
+		b.WriteString(",sum=" + strconv.FormatFloat(v.Sum, 'f', -1, 64))
+		for _, p := range sortedPercentiles(v.Snapshot.Percentiles) {
+			b.WriteString("," + percentileName(p) + "=" + strconv.FormatFloat(v.Snapshot.Percentiles[p], 'f', -1, 64))
+		}
+	default:
+		return ""
+	}
+
+	b.WriteString(" ")
+	b.WriteString(strconv.FormatInt(p.Time.UnixNano(), 10))
+	return b.String()
+}
+
+var (
+	// the line protocol can not escape the newlines, they are escaped like the
+	// spaces, so the line is not broken
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `)
+)
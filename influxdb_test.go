@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"strconv"
+	"testing"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+func TestInfluxDBToLine(t *testing.T) {
+	ts := strconv.FormatInt(testTime.UnixNano(), 10)
+	keys := []metricdata.LabelKey{{Key: "miner"}, {Key: "stage"}}
+
+	cases := []struct {
+		name      string
+		namespace string
+		desc      metricdata.Descriptor
+		values    []metricdata.LabelValue
+		point     metricdata.Point
+		want      string
+	}{
+		{
+			name:   "int64 with tags",
+			desc:   metricdata.Descriptor{Name: "sector_count", LabelKeys: keys},
+			values: []metricdata.LabelValue{metricdata.NewLabelValue("f01000"), metricdata.NewLabelValue("commit")},
+			point:  metricdata.NewInt64Point(testTime, 3),
+			want:   "sector_count,miner=f01000,stage=commit value=3i " + ts,
+		},
+		{
+			name:      "float64 with namespace and missing tag",
+			namespace: "venus",
+			desc:      metricdata.Descriptor{Name: "balance", LabelKeys: keys},
+			values:    []metricdata.LabelValue{metricdata.NewLabelValue("f01000"), {}},
+			point:     metricdata.NewFloat64Point(testTime, 1.25),
+			want:      "venus_balance,miner=f01000 value=1.25 " + ts,
+		},
+		{
+			name:   "escaped",
+			desc:   metricdata.Descriptor{Name: "a b,c", LabelKeys: []metricdata.LabelKey{{Key: "k=1"}}},
+			values: []metricdata.LabelValue{metricdata.NewLabelValue("x,y z\nw")},
+			point:  metricdata.NewInt64Point(testTime, 1),
+			want:   `a\ b\,c,k\=1=x\,y\ z\ w value=1i ` + ts,
+		},
+		{
+			name: "distribution",
+			desc: metricdata.Descriptor{Name: "latency"},
+			point: metricdata.NewDistributionPoint(testTime, &metricdata.Distribution{
+				Count:         3,
+				Sum:           7.5,
+				BucketOptions: &metricdata.BucketOptions{Bounds: []float64{1, 2.5}},
+				Buckets:       []metricdata.Bucket{{Count: 1}, {Count: 1}, {Count: 1}},
+			}),
+			want: "latency count=3i,sum=7.5,le_1=1i,le_2.5=2i,le_inf=3i " + ts,
+		},
+		{
+			name: "summary",
+			desc: metricdata.Descriptor{Name: "latency"},
+			point: metricdata.NewSummaryPoint(testTime, &metricdata.Summary{
+				Count:    2,
+				Sum:      3,
+				Snapshot: metricdata.Snapshot{Percentiles: map[float64]float64{100: 2, 0: 1, 99.9: 2}},
+			}),
+			want: "latency count=2i,sum=3,min=1,p99_9=2,max=2 " + ts,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := &influxDBExporter{namespace: c.namespace}
+			if got := e.toLine(c.desc, c.values, c.point); got != c.want {
+				t.Errorf("expect %q, got %q", c.want, got)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package metrics
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
@@ -14,6 +17,9 @@ type Int64 struct {
 	value     int64
 	measureCt *stats.Int64Measure
 	view      *view.View
+	// summary receives the values instead of the view if the Int64 is created
+	// with a summarizer
+	summary *summarizer
 
 	mux sync.Mutex
 }
@@ -38,35 +44,29 @@ func (i *Int64) Inc(ctx context.Context, v int64) {
 
 // Set sets the value of the gauge to value `v`.
 func (i *Int64) record(ctx context.Context) {
+	if i.summary != nil {
+		i.summary.observe(ctx, float64(i.value))
+		return
+	}
 	stats.Record(ctx, i.measureCt.M(i.value))
 }
 
 // NewInt64 creates a new Int64 Gauge
 func NewInt64(name, desc string, unit string, keys ...tag.Key) *Int64 {
-	if unit == "" {
-		unit = stats.UnitDimensionless
-	}
-
-	iMeasure := stats.Int64(name, desc, unit)
-
-	iView := &view.View{
-		Name:        name,
-		Measure:     iMeasure,
-		Description: desc,
-		Aggregation: view.LastValue(),
-		TagKeys:     keys,
-	}
-	if err := view.Register(iView); err != nil {
+	m, err := TryNewInt64(name, desc, unit, keys...)
+	if err != nil {
 		// a panic here indicates a developer error when creating a view.
 		// Since this method is called in init() methods, this panic when hit
 		// will cause running the program to fail immediately.
 		panic(err)
 	}
+	return m
+}
 
-	return &Int64{
-		measureCt: iMeasure,
-		view:      iView,
-	}
+// TryNewInt64 is NewInt64 returning the error instead of panic, the gauge
+// declared again with the same definition is the registered one.
+func TryNewInt64(name, desc string, unit string, keys ...tag.Key) (*Int64, error) {
+	return newInt64(name, desc, unit, view.LastValue(), keys)
 }
 
 // NewInt64Gauge is just the alias of NewInt64
@@ -74,87 +74,124 @@ func NewInt64Gauge(name, desc string, unit string, keys ...tag.Key) *Int64 {
 	return NewInt64(name, desc, unit, keys...)
 }
 
+// TryNewInt64Gauge is just the alias of TryNewInt64
+func TryNewInt64Gauge(name, desc string, unit string, keys ...tag.Key) (*Int64, error) {
+	return TryNewInt64(name, desc, unit, keys...)
+}
+
 // NewInt64Gauge creates a new Int64 with buckets.
 func NewInt64WithBuckets(name, desc string, unit string, bounds []float64, tagKeys ...tag.Key) *Int64 {
-	if unit == "" {
-		unit = stats.UnitDimensionless
-	}
-
-	iMeasure := stats.Int64(name, desc, unit)
-
-	iView := &view.View{
-		Name:        name,
-		Measure:     iMeasure,
-		Description: desc,
-		Aggregation: view.Distribution(bounds...),
-		TagKeys:     tagKeys,
-	}
-	if err := view.Register(iView); err != nil {
+	m, err := TryNewInt64WithBuckets(name, desc, unit, bounds, tagKeys...)
+	if err != nil {
 		// a panic here indicates a developer error when creating a view.
 		// Since this method is called in init() methods, this panic when hit
 		// will cause running the program to fail immediately.
 		panic(err)
 	}
+	return m
+}
 
-	return &Int64{
-		measureCt: iMeasure,
-		view:      iView,
-	}
+// TryNewInt64WithBuckets is NewInt64WithBuckets returning the error instead of panic
+func TryNewInt64WithBuckets(name, desc string, unit string, bounds []float64, tagKeys ...tag.Key) (*Int64, error) {
+	return newInt64(name, desc, unit, view.Distribution(bounds...), tagKeys)
 }
 
 // NewInt64Counter creates a new Int64 with counter vie
 // if what you want is just a counter please use NewCounter instead
 func NewInt64WithCounter(name, desc string, unit string, keys ...tag.Key) *Int64 {
-	if unit == "" {
-		unit = stats.UnitDimensionless
-	}
-
-	iMeasure := stats.Int64(name, desc, unit)
-	iView := &view.View{
-		Name:        name,
-		Measure:     iMeasure,
-		Description: desc,
-		TagKeys:     keys,
-		Aggregation: view.Count(),
-	}
-	if err := view.Register(iView); err != nil {
+	m, err := TryNewInt64WithCounter(name, desc, unit, keys...)
+	if err != nil {
 		// a panic here indicates a developer error when creating a view.
 		// Since this method is called in init() methods, this panic when hit
 		// will cause running the program to fail immediately.
 		panic(err)
 	}
+	return m
+}
 
-	return &Int64{
-		measureCt: iMeasure,
-		view:      iView,
-	}
+// TryNewInt64WithCounter is NewInt64WithCounter returning the error instead of panic
+func TryNewInt64WithCounter(name, desc string, unit string, keys ...tag.Key) (*Int64, error) {
+	return newInt64(name, desc, unit, view.Count(), keys)
 }
 
-// NewInt64WithSummarizer creates a new Int64 with Summarizer
-func NewInt64WithSummarizer(name, desc string, unit string, keys ...tag.Key) *Int64 {
+// newInt64 registers the Int64 with the view of `agg`
+func newInt64(name, desc string, unit string, agg *view.Aggregation, keys []tag.Key) (*Int64, error) {
 	if unit == "" {
 		unit = stats.UnitDimensionless
 	}
 
-	iMeasure := stats.Int64(name, desc, unit)
-	iView := &view.View{
-		Name:        name,
-		Measure:     iMeasure,
-		Description: desc,
-		TagKeys:     keys,
-		Aggregation: view.Count(),
+	def := newMetricDefinition("Int64", desc, unit, aggregationName(agg), keys)
+	m, err := registered.register(name, def, func() (interface{}, error) {
+		iMeasure := stats.Int64(name, desc, unit)
+		iView := &view.View{
+			Name:        name,
+			Measure:     iMeasure,
+			Description: desc,
+			Aggregation: agg,
+			TagKeys:     keys,
+		}
+		if err := view.Register(iView); err != nil {
+			return nil, err
+		}
+		return &Int64{
+			measureCt: iMeasure,
+			view:      iView,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if err := view.Register(iView); err != nil {
+	return m.(*Int64), nil
+}
+
+// NewInt64WithSummarizer creates a new Int64 with Summarizer, it reports the
+// count and sum of all the values, and the min, max and DefaultQuantiles of the
+// values in the last DefaultSummaryMaxAge.
+func NewInt64WithSummarizer(name, desc string, unit string, keys ...tag.Key) *Int64 {
+	return NewInt64WithQuantiles(name, desc, unit, DefaultQuantiles, DefaultSummaryMaxAge, keys...)
+}
+
+// TryNewInt64WithSummarizer is NewInt64WithSummarizer returning the error instead
+// of panic
+func TryNewInt64WithSummarizer(name, desc string, unit string, keys ...tag.Key) (*Int64, error) {
+	return TryNewInt64WithQuantiles(name, desc, unit, DefaultQuantiles, DefaultSummaryMaxAge, keys...)
+}
+
+// NewInt64WithQuantiles creates a new Int64 with Summarizer, it reports the count
+// and sum of all the values, and the min, max and `quantiles` of the values in the
+// last `maxAge`. The quantiles must be in (0, 1).
+func NewInt64WithQuantiles(name, desc string, unit string, quantiles []float64, maxAge time.Duration, keys ...tag.Key) *Int64 {
+	m, err := TryNewInt64WithQuantiles(name, desc, unit, quantiles, maxAge, keys...)
+	if err != nil {
 		// a panic here indicates a developer error when creating a view.
 		// Since this method is called in init() methods, this panic when hit
 		// will cause running the program to fail immediately.
 		panic(err)
 	}
+	return m
+}
+
+// TryNewInt64WithQuantiles is NewInt64WithQuantiles returning the error instead
+// of panic
+func TryNewInt64WithQuantiles(name, desc string, unit string, quantiles []float64, maxAge time.Duration, keys ...tag.Key) (*Int64, error) {
+	if unit == "" {
+		unit = stats.UnitDimensionless
+	}
 
-	return &Int64{
-		measureCt: iMeasure,
-		view:      iView,
+	def := newMetricDefinition("Int64", desc, unit, summaryAggregationName(quantiles, maxAge), keys)
+	m, err := registered.register(name, def, func() (interface{}, error) {
+		summary, err := newSummarizer(name, desc, unit, quantiles, maxAge, keys)
+		if err != nil {
+			return nil, err
+		}
+		return &Int64{
+			summary: summary,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return m.(*Int64), nil
 }
 
 type Counter Int64
@@ -168,6 +205,12 @@ func NewCounter(name, desc string, keys ...tag.Key) *Counter {
 	return (*Counter)(NewInt64WithCounter(name, desc, "", keys...))
 }
 
+// TryNewCounter is NewCounter returning the error instead of panic
+func TryNewCounter(name, desc string, keys ...tag.Key) (*Counter, error) {
+	i, err := TryNewInt64WithCounter(name, desc, "", keys...)
+	return (*Counter)(i), err
+}
+
 var tagCategory = tag.MustNewKey("category")
 
 type Int64WithCategory struct {
@@ -208,43 +251,159 @@ func (i *Int64WithCategory) Inc(ctx context.Context, category string, v int64) {
 }
 
 func NewInt64WithCategory(name, desc string, unit string, keys ...tag.Key) *Int64WithCategory {
+	m, err := TryNewInt64WithCategory(name, desc, unit, keys...)
+	if err != nil {
+		// a panic here indicates a developer error when creating a view.
+		// Since this method is called in init() methods, this panic when hit
+		// will cause running the program to fail immediately.
+		panic(err)
+	}
+	return m
+}
+
+// TryNewInt64WithCategory is NewInt64WithCategory returning the error instead of
+// panic
+func TryNewInt64WithCategory(name, desc string, unit string, keys ...tag.Key) (*Int64WithCategory, error) {
 	keys = append(keys, tagCategory)
 	if unit == "" {
 		unit = stats.UnitDimensionless
 	}
 
-	iMeasure := stats.Int64(name, desc, unit)
+	def := newMetricDefinition("Int64WithCategory", desc, unit, aggregationName(view.LastValue()), keys)
+	m, err := registered.register(name, def, func() (interface{}, error) {
+		iMeasure := stats.Int64(name, desc, unit)
+		iView := &view.View{
+			Name:        name,
+			Measure:     iMeasure,
+			Description: desc,
+			Aggregation: view.LastValue(),
+			TagKeys:     keys,
+		}
+		if err := view.Register(iView); err != nil {
+			return nil, err
+		}
+		return &Int64WithCategory{
+			measureCt: iMeasure,
+			view:      iView,
+			value:     make(map[string]int64),
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m.(*Int64WithCategory), nil
+}
+
+type CounterWithCategory Int64WithCategory
+
+// Tick triggers a record with value 1
+func (c *CounterWithCategory) Tick(ctx context.Context, category string) {
+	(*Int64WithCategory)(c).Set(ctx, category, 1)
+}
+
+func NewCounterWithCategory(name, desc string, keys ...tag.Key) *CounterWithCategory {
+	return (*CounterWithCategory)(NewInt64WithCategory(name, desc, "", keys...))
+}
 
-	iView := &view.View{
-		Name:        name,
-		Measure:     iMeasure,
-		Description: desc,
-		Aggregation: view.LastValue(),
-		TagKeys:     keys,
+// TryNewCounterWithCategory is NewCounterWithCategory returning the error instead
+// of panic
+func TryNewCounterWithCategory(name, desc string, keys ...tag.Key) (*CounterWithCategory, error) {
+	i, err := TryNewInt64WithCategory(name, desc, "", keys...)
+	return (*CounterWithCategory)(i), err
+}
+
+// SumCounter is a monotonic counter that adds arbitrary amounts, unlike Counter,
+// which counts the calls. It is exported with the `_total` suffix, which is the
+// prometheus naming convention for counters.
+type SumCounter struct {
+	measureCt *stats.Int64Measure
+	view      *view.View
+}
+
+// Add increments the counter by `n`, the negative `n` is rejected.
+func (c *SumCounter) Add(ctx context.Context, n int64) error {
+	if n < 0 {
+		return fmt.Errorf("counter %s can not be decreased by %d", c.view.Name, n)
 	}
-	if err := view.Register(iView); err != nil {
+	stats.Record(ctx, c.measureCt.M(n))
+	return nil
+}
+
+// NewSumCounter creates a new SumCounter
+func NewSumCounter(name, desc string, unit string, keys ...tag.Key) *SumCounter {
+	m, err := TryNewSumCounter(name, desc, unit, keys...)
+	if err != nil {
 		// a panic here indicates a developer error when creating a view.
 		// Since this method is called in init() methods, this panic when hit
 		// will cause running the program to fail immediately.
 		panic(err)
 	}
+	return m
+}
 
-	value := make(map[string]int64)
+// TryNewSumCounter is NewSumCounter returning the error instead of panic
+func TryNewSumCounter(name, desc string, unit string, keys ...tag.Key) (*SumCounter, error) {
+	if unit == "" {
+		unit = stats.UnitDimensionless
+	}
 
-	return &Int64WithCategory{
-		measureCt: iMeasure,
-		view:      iView,
-		value:     value,
+	viewName := counterName(name)
+	def := newMetricDefinition("SumCounter", desc, unit, aggregationName(view.Sum()), keys)
+	m, err := registered.register(viewName, def, func() (interface{}, error) {
+		iMeasure := stats.Int64(viewName, desc, unit)
+		iView := &view.View{
+			Name:        viewName,
+			Measure:     iMeasure,
+			Description: desc,
+			TagKeys:     keys,
+			Aggregation: view.Sum(),
+		}
+		if err := view.Register(iView); err != nil {
+			return nil, err
+		}
+		return &SumCounter{
+			measureCt: iMeasure,
+			view:      iView,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return m.(*SumCounter), nil
 }
 
-type CounterWithCategory Int64WithCategory
+// SumCounterWithCategory is a SumCounter with the category tag
+type SumCounterWithCategory SumCounter
 
-// Tick triggers a record with value 1
-func (c *CounterWithCategory) Tick(ctx context.Context, category string) {
-	(*Int64WithCategory)(c).Set(ctx, category, 1)
+// Add increments the counter of `category` by `n`, the negative `n` is rejected.
+func (c *SumCounterWithCategory) Add(ctx context.Context, category string, n int64) error {
+	ctx, err := tag.New(ctx, tag.Insert(tagCategory, category))
+	if err != nil {
+		return err
+	}
+	return (*SumCounter)(c).Add(ctx, n)
 }
 
-func NewCounterWithCategory(name, desc string, keys ...tag.Key) *CounterWithCategory {
-	return (*CounterWithCategory)(NewInt64WithCategory(name, desc, "", keys...))
+func NewSumCounterWithCategory(name, desc string, unit string, keys ...tag.Key) *SumCounterWithCategory {
+	keys = append(keys, tagCategory)
+	return (*SumCounterWithCategory)(NewSumCounter(name, desc, unit, keys...))
+}
+
+// TryNewSumCounterWithCategory is NewSumCounterWithCategory returning the error
+// instead of panic
+func TryNewSumCounterWithCategory(name, desc string, unit string, keys ...tag.Key) (*SumCounterWithCategory, error) {
+	keys = append(keys, tagCategory)
+	c, err := TryNewSumCounter(name, desc, unit, keys...)
+	return (*SumCounterWithCategory)(c), err
+}
+
+// counterName is the name of the view and the measure of a counter, which is
+// `name` with the `_total` suffix appended if missing. The measure is named like
+// the view, so it is not shared with the gauge `name`, whose values would be
+// summed by the counter.
+func counterName(name string) string {
+	if strings.HasSuffix(name, "_total") {
+		return name
+	}
+	return name + "_total"
 }
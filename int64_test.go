@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+)
+
+func TestSumCounterName(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{name: "sum_counter_sent", want: "sum_counter_sent_total"},
+		{name: "sum_counter_bytes_total", want: "sum_counter_bytes_total"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			counter, err := TryNewSumCounter(c.name, "d", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counter.view.Name != c.want {
+				t.Errorf("expect view %s, got %s", c.want, counter.view.Name)
+			}
+			if counter.measureCt.Name() != c.want {
+				t.Errorf("expect measure %s, got %s", c.want, counter.measureCt.Name())
+			}
+		})
+	}
+}
+
+func TestSumCounterAdd(t *testing.T) {
+	ctx := context.Background()
+	counter, err := TryNewSumCounter("sum_counter_add", "d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := viewSum(t, "sum_counter_add_total")
+
+	for _, n := range []int64{3, 4} {
+		if err := counter.Add(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := counter.Add(ctx, -1); err == nil {
+		t.Error("expect the negative amount to be rejected")
+	}
+
+	if got := viewSum(t, "sum_counter_add_total") - before; got != 7 {
+		t.Errorf("expect the counter to be increased by 7, got %v", got)
+	}
+}
+
+// the counters are registered as `<name>_total`, their measures are not shared
+// with the gauges of `name`
+func TestSumCounterAndGaugeOfSameName(t *testing.T) {
+	ctx := context.Background()
+	gauge, err := TryNewInt64("sum_counter_shared", "d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err := TryNewSumCounter("sum_counter_shared", "d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := viewSum(t, "sum_counter_shared_total")
+
+	gauge.Set(ctx, 100)
+	if err := counter.Add(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := viewSum(t, "sum_counter_shared_total") - before; got != 1 {
+		t.Errorf("expect the counter to be increased by 1, got %v", got)
+	}
+}
+
+// viewSum returns the sum of the view `name`, it waits for the recorded values
+func viewSum(t *testing.T, name string) float64 {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 {
+		return 0
+	}
+	return rows[0].Data.(*view.SumData).Value
+}
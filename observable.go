@@ -0,0 +1,283 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// DefaultObserveTimeout is the time the callbacks of the observable gauges have
+// to return, the last values are reported for the slow callbacks.
+var DefaultObserveTimeout = time.Second
+
+// Int64Observer receives the values of an Int64 observable gauge
+type Int64Observer struct {
+	*observer
+}
+
+// Observe reports `v` for the tags, the tags not in the keys of the gauge are
+// ignored.
+func (o *Int64Observer) Observe(v int64, tags ...tag.Mutator) {
+	o.observe(v, tags)
+}
+
+// Float64Observer receives the values of a Float64 observable gauge
+type Float64Observer struct {
+	*observer
+}
+
+// Observe reports `v` for the tags, the tags not in the keys of the gauge are
+// ignored.
+func (o *Float64Observer) Observe(v float64, tags ...tag.Mutator) {
+	o.observe(v, tags)
+}
+
+type observer struct {
+	keys   []tag.Key
+	series []*metricdata.TimeSeries
+	now    time.Time
+}
+
+func (o *observer) observe(v interface{}, tags []tag.Mutator) {
+	ctx, err := tag.New(context.Background(), tags...)
+	if err != nil {
+		log.Warnf("invalid tags of observed value: %s", err)
+		return
+	}
+	m := tag.FromContext(ctx)
+	values := make([]metricdata.LabelValue, len(o.keys))
+	for i, k := range o.keys {
+		if value, ok := m.Value(k); ok {
+			values[i] = metricdata.NewLabelValue(value)
+		}
+	}
+
+	var p metricdata.Point
+	switch v := v.(type) {
+	case int64:
+		p = metricdata.NewInt64Point(o.now, v)
+	case float64:
+		p = metricdata.NewFloat64Point(o.now, v)
+	}
+	o.series = append(o.series, &metricdata.TimeSeries{
+		LabelValues: values,
+		Points:      []metricdata.Point{p},
+	})
+}
+
+// ObservableGauge is a gauge whose values are read by a callback, which is called
+// each time the exporters read the metrics, once per reporting period or scrape.
+type ObservableGauge struct {
+	desc     metricdata.Descriptor
+	keys     []tag.Key
+	callback func(ctx context.Context, o *observer)
+
+	mux     sync.Mutex
+	last    []*metricdata.TimeSeries
+	running bool
+}
+
+// NewInt64ObservableGauge creates a gauge reporting the values observed by
+// `callback`, the values of several tag sets can be observed in one call.
+func NewInt64ObservableGauge(name, desc, unit string, callback func(ctx context.Context, o *Int64Observer), keys ...tag.Key) *ObservableGauge {
+	return mustObservableGauge(TryNewInt64ObservableGauge(name, desc, unit, callback, keys...))
+}
+
+// TryNewInt64ObservableGauge is NewInt64ObservableGauge returning the error
+// instead of panic. Unlike the other metrics, the gauge can not be declared
+// again, since the callbacks can not be compared.
+func TryNewInt64ObservableGauge(name, desc, unit string, callback func(ctx context.Context, o *Int64Observer), keys ...tag.Key) (*ObservableGauge, error) {
+	return newObservableGauge(name, desc, unit, metricdata.TypeGaugeInt64, func(ctx context.Context, o *observer) {
+		callback(ctx, &Int64Observer{observer: o})
+	}, keys)
+}
+
+// NewFloat64ObservableGauge creates a gauge reporting the values observed by
+// `callback`, the values of several tag sets can be observed in one call.
+func NewFloat64ObservableGauge(name, desc, unit string, callback func(ctx context.Context, o *Float64Observer), keys ...tag.Key) *ObservableGauge {
+	return mustObservableGauge(TryNewFloat64ObservableGauge(name, desc, unit, callback, keys...))
+}
+
+// TryNewFloat64ObservableGauge is NewFloat64ObservableGauge returning the error
+// instead of panic, the gauge can not be declared again.
+func TryNewFloat64ObservableGauge(name, desc, unit string, callback func(ctx context.Context, o *Float64Observer), keys ...tag.Key) (*ObservableGauge, error) {
+	return newObservableGauge(name, desc, unit, metricdata.TypeGaugeFloat64, func(ctx context.Context, o *observer) {
+		callback(ctx, &Float64Observer{observer: o})
+	}, keys)
+}
+
+func mustObservableGauge(g *ObservableGauge, err error) *ObservableGauge {
+	if err != nil {
+		// a panic here indicates a developer error when creating a view.
+		// Since this method is called in init() methods, this panic when hit
+		// will cause running the program to fail immediately.
+		panic(err)
+	}
+	return g
+}
+
+func newObservableGauge(name, desc, unit string, typ metricdata.Type, callback func(ctx context.Context, o *observer), keys []tag.Key) (*ObservableGauge, error) {
+	if unit == "" {
+		unit = stats.UnitDimensionless
+	}
+	labelKeys := make([]metricdata.LabelKey, len(keys))
+	for i, k := range keys {
+		labelKeys[i] = metricdata.LabelKey{Key: k.Name()}
+	}
+
+	g := &ObservableGauge{
+		desc: metricdata.Descriptor{
+			Name:        name,
+			Description: desc,
+			Unit:        metricdata.Unit(unit),
+			Type:        typ,
+			LabelKeys:   labelKeys,
+		},
+		keys:     keys,
+		callback: callback,
+	}
+	kind := "Int64ObservableGauge"
+	if typ == metricdata.TypeGaugeFloat64 {
+		kind = "Float64ObservableGauge"
+	}
+	def := newMetricDefinition(kind, desc, unit, aggregationName(view.LastValue()), keys)
+	def.unique = true
+	if _, err := registered.register(name, def, func() (interface{}, error) {
+		return g, gauges.add(g)
+	}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Unregister stops reporting the gauge, then the gauge can be declared again
+func (g *ObservableGauge) Unregister() {
+	gauges.remove(g)
+	registered.unregister(g.desc.Name, g)
+}
+
+// observe calls the callback with timeout, the callback still running from the
+// last read is not called again, and the last values are reported meanwhile.
+func (g *ObservableGauge) observe() *metricdata.Metric {
+	g.mux.Lock()
+	if g.running {
+		last := g.last
+		g.mux.Unlock()
+		return g.metric(last)
+	}
+	g.running = true
+	g.mux.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultObserveTimeout)
+	defer cancel()
+
+	done := make(chan []*metricdata.TimeSeries, 1)
+	go func() {
+		o := &observer{keys: g.keys, now: time.Now()}
+		defer func() {
+			if p := recover(); p != nil {
+				log.Errorf("callback of gauge %s panics: %v", g.desc.Name, p)
+				// the values observed before the panic are incomplete
+				o.series = nil
+			}
+			g.mux.Lock()
+			g.last = o.series
+			g.running = false
+			g.mux.Unlock()
+			done <- o.series
+		}()
+		g.callback(ctx, o)
+	}()
+
+	select {
+	case series := <-done:
+		return g.metric(series)
+	case <-ctx.Done():
+		log.Warnf("callback of gauge %s did not return in %s", g.desc.Name, DefaultObserveTimeout)
+		g.mux.Lock()
+		last := g.last
+		g.mux.Unlock()
+		return g.metric(last)
+	}
+}
+
+func (g *ObservableGauge) metric(series []*metricdata.TimeSeries) *metricdata.Metric {
+	if len(series) == 0 {
+		return nil
+	}
+	return &metricdata.Metric{
+		Descriptor: g.desc,
+		TimeSeries: series,
+	}
+}
+
+// gaugeProducer produces the metrics of the observable gauges, it is added to
+// the global producer manager like summaryProducer.
+type gaugeProducer struct {
+	mux    sync.Mutex
+	gauges map[string]*ObservableGauge
+	once   sync.Once
+}
+
+var gauges = &gaugeProducer{gauges: make(map[string]*ObservableGauge)}
+
+func (p *gaugeProducer) add(g *ObservableGauge) error {
+	p.once.Do(func() {
+		metricproducer.GlobalManager().AddProducer(p)
+	})
+
+	if err := checkViewUnregistered(g.desc.Name); err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.gauges[g.desc.Name] = g
+	return nil
+}
+
+func (p *gaugeProducer) remove(g *ObservableGauge) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.gauges[g.desc.Name] == g {
+		delete(p.gauges, g.desc.Name)
+	}
+}
+
+// Read implements metricproducer.Producer, the callbacks are called concurrently,
+// so a slow one does not delay the others.
+func (p *gaugeProducer) Read() []*metricdata.Metric {
+	p.mux.Lock()
+	list := make([]*ObservableGauge, 0, len(p.gauges))
+	for _, g := range p.gauges {
+		list = append(list, g)
+	}
+	p.mux.Unlock()
+
+	results := make([]*metricdata.Metric, len(list))
+	var wg sync.WaitGroup
+	for i, g := range list {
+		wg.Add(1)
+		go func(i int, g *ObservableGauge) {
+			defer wg.Done()
+			results[i] = g.observe()
+		}(i, g)
+	}
+	wg.Wait()
+
+	metrics := make([]*metricdata.Metric, 0, len(results))
+	for _, m := range results {
+		if m != nil {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/tag"
+)
+
+// observedValues returns the values of the metric by the joined label values
+func observedValues(m *metricdata.Metric) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	values := make(map[string]interface{})
+	for _, ts := range m.TimeSeries {
+		values[labelValuesKey(ts.LabelValues)] = ts.Points[0].Value
+	}
+	return values
+}
+
+func TestObservableGaugeTags(t *testing.T) {
+	miner, stage, other := tag.MustNewKey("miner"), tag.MustNewKey("stage"), tag.MustNewKey("other")
+	g, err := TryNewInt64ObservableGauge("observable_tags", "d", "", func(ctx context.Context, o *Int64Observer) {
+		o.Observe(1, tag.Insert(miner, "f01000"), tag.Insert(stage, "commit"))
+		// the missing tag is empty, and the tags not in the keys are ignored
+		o.Observe(2, tag.Insert(miner, "f02000"), tag.Insert(other, "x"))
+		// the invalid tag value is dropped
+		o.Observe(3, tag.Insert(miner, "\x00"))
+	}, miner, stage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Unregister)
+
+	m := g.observe()
+	if m == nil {
+		t.Fatal("expect the observed metric")
+	}
+	if m.Descriptor.Type != metricdata.TypeGaugeInt64 || !reflect.DeepEqual(m.Descriptor.LabelKeys, []metricdata.LabelKey{{Key: "miner"}, {Key: "stage"}}) {
+		t.Errorf("unexpected descriptor %+v", m.Descriptor)
+	}
+	want := map[string]interface{}{
+		labelValuesKey([]metricdata.LabelValue{metricdata.NewLabelValue("f01000"), metricdata.NewLabelValue("commit")}): int64(1),
+		labelValuesKey([]metricdata.LabelValue{metricdata.NewLabelValue("f02000"), {}}):                                 int64(2),
+	}
+	if got := observedValues(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("expect %v, got %v", want, got)
+	}
+}
+
+func TestObservableGaugePanic(t *testing.T) {
+	var calls int32
+	g, err := TryNewFloat64ObservableGauge("observable_panic", "d", "", func(ctx context.Context, o *Float64Observer) {
+		o.Observe(1.5)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("observe failed")
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Unregister)
+
+	// the values observed before the panic are dropped
+	if m := g.observe(); m != nil {
+		t.Errorf("expect no metric after the panic, got %v", observedValues(m))
+	}
+	if got := observedValues(g.observe()); !reflect.DeepEqual(got, map[string]interface{}{"": 1.5}) {
+		t.Errorf("expect the gauge to be observed after the panic, got %v", got)
+	}
+}
+
+func TestObservableGaugeTimeout(t *testing.T) {
+	timeout := DefaultObserveTimeout
+	DefaultObserveTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { DefaultObserveTimeout = timeout })
+
+	var calls int32
+	release := make(chan struct{})
+	g, err := TryNewInt64ObservableGauge("observable_timeout", "d", "", func(ctx context.Context, o *Int64Observer) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 2 {
+			// ignores the cancellation of ctx
+			<-release
+		}
+		o.Observe(int64(n))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.Unregister)
+
+	if got := observedValues(g.observe()); !reflect.DeepEqual(got, map[string]interface{}{"": int64(1)}) {
+		t.Fatalf("expect 1, got %v", got)
+	}
+	// the slow callback times out, the last values are reported
+	if got := observedValues(g.observe()); !reflect.DeepEqual(got, map[string]interface{}{"": int64(1)}) {
+		t.Errorf("expect the last value 1 on timeout, got %v", got)
+	}
+	// the callback still running is not called again
+	if got := observedValues(g.observe()); !reflect.DeepEqual(got, map[string]interface{}{"": int64(1)}) {
+		t.Errorf("expect the last value 1 while the callback is running, got %v", got)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expect the callback to be called twice, got %d", n)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		g.mux.Lock()
+		running := g.running
+		g.mux.Unlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the slow callback does not return")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := observedValues(g.observe()); !reflect.DeepEqual(got, map[string]interface{}{"": int64(3)}) {
+		t.Errorf("expect 3 after the slow callback returns, got %v", got)
+	}
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/bridge/opencensus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+type OTLPProtocol string
+
+const (
+	OTLPGRPC OTLPProtocol = "grpc"
+	OTLPHTTP OTLPProtocol = "http"
+)
+
+// RegisterOTLPExporter register the otlp exporter, all the opencensus views (Int64, Counter,
+// Float64Timer ...) are read through the opencensus bridge and pushed to an OpenTelemetry
+// collector every push interval.
+func RegisterOTLPExporter(ctx context.Context, cfg *MetricsOTLPExporterConfig) error {
+	e, err := newOTLPExporter(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Info("context done")
+
+		if err := e.Shutdown(context.TODO()); err != nil {
+			log.Errorf("shutting down otlp exporter failed: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+type otlpExporter struct {
+	mp *sdkmetric.MeterProvider
+}
+
+func newOTLPExporter(ctx context.Context, cfg *MetricsOTLPExporterConfig) (*otlpExporter, error) {
+	pushInterval, err := time.ParseDuration(cfg.PushInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := newOTLPMetricExporter(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+	}
+
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(pushInterval),
+		sdkmetric.WithProducer(opencensus.NewMetricProducer()),
+	)
+
+	log.Infof("Start otlp exporter, push to %s over %s", cfg.Endpoint, cfg.Protocol)
+	return &otlpExporter{mp: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))}, nil
+}
+
+// Shutdown collects and pushes the metrics for the last time
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	return e.mp.Shutdown(ctx)
+}
+
+func newOTLPMetricExporter(ctx context.Context, cfg *MetricsOTLPExporterConfig) (sdkmetric.Exporter, error) {
+	switch cfg.Protocol {
+	case OTLPGRPC:
+		opts := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithEndpoint(cfg.Endpoint),
+			otlpmetricgrpc.WithHeaders(cfg.Headers),
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+		switch cfg.Compression {
+		case "", "none":
+		case "gzip":
+			opts = append(opts, otlpmetricgrpc.WithCompressor("gzip"))
+		default:
+			return nil, fmt.Errorf("unsupported compression: %s", cfg.Compression)
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	case OTLPHTTP:
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpoint(cfg.Endpoint),
+			otlpmetrichttp.WithHeaders(cfg.Headers),
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		switch cfg.Compression {
+		case "", "none":
+			opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.NoCompression))
+		case "gzip":
+			opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+		default:
+			return nil, fmt.Errorf("unsupported compression: %s", cfg.Compression)
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("wrong otlp protocol: %s", cfg.Protocol)
+	}
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+)
+
+func TestOTLPExporterHTTP(t *testing.T) {
+	var (
+		mux    sync.Mutex
+		bodies [][]byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if r.Header.Get("X-Tenant") != "venus" {
+			t.Errorf("expect the configured header, got %v", r.Header)
+		}
+		mux.Lock()
+		bodies = append(bodies, body)
+		mux.Unlock()
+	}))
+	defer srv.Close()
+
+	gauge, err := TryNewInt64("otlp_test_gauge", "d", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gauge.Set(context.Background(), 3)
+	// waits for the value to be recorded
+	if _, err := view.RetrieveData("otlp_test_gauge"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newMetricsOTLPExporterConfig()
+	cfg.Protocol = OTLPHTTP
+	cfg.Endpoint = strings.TrimPrefix(srv.URL, "http://")
+	cfg.Insecure = true
+	cfg.Headers = map[string]string{"X-Tenant": "venus"}
+	// the metrics are only pushed on shutdown
+	cfg.PushInterval = "1h"
+
+	e, err := newOTLPExporter(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("expect 1 push, got %d", len(bodies))
+	}
+	// the names are plain strings in the protobuf message
+	if !bytes.Contains(bodies[0], []byte("otlp_test_gauge")) {
+		t.Errorf("expect otlp_test_gauge to be pushed")
+	}
+}
+
+func TestOTLPMetricExporterConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(cfg *MetricsOTLPExporterConfig)
+		err    string
+	}{
+		{
+			name: "grpc",
+			modify: func(cfg *MetricsOTLPExporterConfig) {
+				cfg.Protocol = OTLPGRPC
+				cfg.Compression = "gzip"
+			},
+		},
+		{
+			name: "http",
+			modify: func(cfg *MetricsOTLPExporterConfig) {
+				cfg.Protocol = OTLPHTTP
+			},
+		},
+		{
+			name: "unknown protocol",
+			modify: func(cfg *MetricsOTLPExporterConfig) {
+				cfg.Protocol = "thrift"
+			},
+			err: "wrong otlp protocol: thrift",
+		},
+		{
+			name: "unknown compression",
+			modify: func(cfg *MetricsOTLPExporterConfig) {
+				cfg.Protocol = OTLPHTTP
+				cfg.Compression = "zstd"
+			},
+			err: "unsupported compression: zstd",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := newMetricsOTLPExporterConfig()
+			c.modify(cfg)
+			e, err := newOTLPMetricExporter(context.Background(), cfg)
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Errorf("expect error %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = e.Shutdown(context.Background())
+		})
+	}
+}
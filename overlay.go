@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The config can be overlaid by env vars and flags, the precedence from low to
+// high is: the defaults, the config file, the env vars, the flags. So a service
+// loads its config file first, then calls ApplyEnv, then parses the flags bound
+// by BindFlags.
+//
+// The env var and the flag of a field are named after the json path of the
+// field, e.g. with the prefix `VENUS_METRICS` and `metrics`, the field
+// `exporter.prometheus.endPoint` of MetricsConfig is set by the env var
+// `VENUS_METRICS_EXPORTER_PROMETHEUS_END_POINT` and the flag
+// `--metrics-exporter-prometheus-end-point`.
+//
+// The values of the lists are separated by commas, e.g. `prometheus,graphite`,
+// and the maps are given as `key1=value1,key2=value2`. The lists of structs,
+// like the sampler rules, can only be set by the config file.
+
+// ApplyEnv overrides the fields of `cfg`, which must be a pointer to a config
+// struct, with the env vars starting with `prefix`.
+func ApplyEnv(prefix string, cfg interface{}) error {
+	fields, err := configFields(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		name := f.envName(prefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := f.set(value); err != nil {
+			return fmt.Errorf("invalid env %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// BindFlags defines a flag in `fs` for each field of `cfg`, which must be a
+// pointer to a config struct. Only the flags given in the command line override
+// the fields, so `fs` should be parsed after the config file and the env vars
+// are applied.
+func BindFlags(fs *flag.FlagSet, prefix string, cfg interface{}) error {
+	fields, err := configFields(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		fs.Var(&configFlag{field: f}, f.flagName(prefix), "overrides "+strings.Join(f.path, "."))
+	}
+	return nil
+}
+
+type configField struct {
+	// path is the json names from the root to the field
+	path []string
+	typ  reflect.Type
+	// get returns the field, the nil pointers on the path are allocated if
+	// `alloc` is true, otherwise it returns false on a nil pointer.
+	get func(alloc bool) (reflect.Value, bool)
+}
+
+func configFields(cfg interface{}) ([]configField, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config must be a pointer to struct, got %T", cfg)
+	}
+
+	var fields []configField
+	collectConfigFields(func(bool) (reflect.Value, bool) { return v.Elem(), true }, v.Elem().Type(), nil, &fields)
+	return fields, nil
+}
+
+func collectConfigFields(get func(bool) (reflect.Value, bool), t reflect.Type, path []string, fields *[]configField) {
+	switch {
+	case t.Kind() == reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if !sf.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+
+			i := i
+			collectConfigFields(func(alloc bool) (reflect.Value, bool) {
+				s, ok := get(alloc)
+				if !ok {
+					return reflect.Value{}, false
+				}
+				return s.Field(i), true
+			}, sf.Type, append(append([]string(nil), path...), name), fields)
+		}
+	case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct:
+		collectConfigFields(func(alloc bool) (reflect.Value, bool) {
+			p, ok := get(alloc)
+			if !ok {
+				return reflect.Value{}, false
+			}
+			if p.IsNil() {
+				if !alloc {
+					return reflect.Value{}, false
+				}
+				p.Set(reflect.New(t.Elem()))
+			}
+			return p.Elem(), true
+		}, t.Elem(), path, fields)
+	case isConfigValueType(t):
+		*fields = append(*fields, configField{path: path, typ: t, get: get})
+	}
+}
+
+func isConfigValueType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint64, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String
+	default:
+		return false
+	}
+}
+
+// secretFields are the json names of the fields holding secrets
+var secretFields = map[string]bool{
+	"password":       true,
+	"jaegerPassword": true,
+	"token":          true,
+	"bearerToken":    true,
+	"basicAuthUsers": true,
+}
+
+func (f configField) secret() bool {
+	return len(f.path) > 0 && secretFields[f.path[len(f.path)-1]]
+}
+
+func (f configField) envName(prefix string) string {
+	names := []string{prefix}
+	for _, p := range f.path {
+		names = append(names, strings.ToUpper(strings.Join(splitCamelCase(p), "_")))
+	}
+	return strings.Join(names, "_")
+}
+
+func (f configField) flagName(prefix string) string {
+	names := []string{prefix}
+	for _, p := range f.path {
+		names = append(names, strings.ToLower(strings.Join(splitCamelCase(p), "-")))
+	}
+	return strings.Join(names, "-")
+}
+
+func (f configField) set(s string) error {
+	v, _ := f.get(true)
+	switch f.typ.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float64:
+		fv, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(fv)
+	case reflect.Slice:
+		list := reflect.MakeSlice(f.typ, 0, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item).Convert(f.typ.Elem()))
+			}
+		}
+		v.Set(list)
+	case reflect.Map:
+		m := reflect.MakeMap(f.typ)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("expect key=value, got %q", item)
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(f.typ.Key()), reflect.ValueOf(value).Convert(f.typ.Elem()))
+		}
+		v.Set(m)
+	}
+	return nil
+}
+
+// String formats the value of the field like the input of set, or returns empty
+// if any pointer on the path is nil.
+func (f configField) String() string {
+	v, ok := f.get(false)
+	if !ok {
+		return ""
+	}
+	switch f.typ.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	case reflect.Map:
+		items := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			items = append(items, iter.Key().String()+"="+iter.Value().String())
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// configFlag implements flag.Value, the value is written to the field when the
+// flag is parsed.
+type configFlag struct {
+	field configField
+}
+
+func (f *configFlag) String() string {
+	// the flag package calls String on a zero value to decide the default
+	if f == nil || f.field.get == nil {
+		return ""
+	}
+	// the default is printed by `-h`, the secrets loaded from the config file
+	// must not be shown
+	if f.field.secret() {
+		return ""
+	}
+	return f.field.String()
+}
+
+func (f *configFlag) Set(s string) error {
+	return f.field.set(s)
+}
+
+// IsBoolFlag allows the bool flags to be given without value
+func (f *configFlag) IsBoolFlag() bool {
+	return f.field.typ != nil && f.field.typ.Kind() == reflect.Bool
+}
+
+// splitCamelCase splits `clientCAFile` into `client`, `CA` and `File`
+func splitCamelCase(s string) []string {
+	var words []string
+	runes := []rune(s)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		lowerToUpper := unicode.IsUpper(cur) && (unicode.IsLower(prev) || unicode.IsDigit(prev))
+		acronymEnd := unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if lowerToUpper || acronymEnd {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
@@ -0,0 +1,218 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	cases := []struct {
+		name string
+		// prepare changes the config loaded from the file
+		prepare func(cfg *MetricsConfig)
+		env     map[string]string
+		check   func(t *testing.T, cfg *MetricsConfig)
+		err     bool
+	}{
+		{
+			name: "scalars",
+			env: map[string]string{
+				"VENUS_METRICS_ENABLED":                       "true",
+				"VENUS_METRICS_EXPORTER_PROMETHEUS_END_POINT": "/ip4/127.0.0.1/tcp/9090",
+				"VENUS_METRICS_EXPORTER_GRAPHITE_PORT":        "2003",
+			},
+			check: func(t *testing.T, cfg *MetricsConfig) {
+				if !cfg.Enabled || cfg.Exporter.Prometheus.EndPoint != "/ip4/127.0.0.1/tcp/9090" || cfg.Exporter.Graphite.Port != 2003 {
+					t.Errorf("env not applied: %+v %+v", cfg, cfg.Exporter.Graphite)
+				}
+			},
+		},
+		{
+			name: "list and map",
+			env: map[string]string{
+				"VENUS_METRICS_EXPORTER_TYPES":                "prometheus, graphite,",
+				"VENUS_METRICS_EXPORTER_PUSHGATEWAY_GROUPING": "miner=f01000,zone=a",
+			},
+			check: func(t *testing.T, cfg *MetricsConfig) {
+				if want := []ExporterType{ETPrometheus, ETGraphite}; !reflect.DeepEqual(cfg.Exporter.Types, want) {
+					t.Errorf("expect types %v, got %v", want, cfg.Exporter.Types)
+				}
+				if want := map[string]string{"miner": "f01000", "zone": "a"}; !reflect.DeepEqual(cfg.Exporter.Pushgateway.Grouping, want) {
+					t.Errorf("expect grouping %v, got %v", want, cfg.Exporter.Pushgateway.Grouping)
+				}
+			},
+		},
+		{
+			name: "acronym in the field name",
+			env: map[string]string{
+				"VENUS_METRICS_EXPORTER_PROMETHEUS_TLS_CLIENT_CA_FILE": "/etc/ca.pem",
+			},
+			check: func(t *testing.T, cfg *MetricsConfig) {
+				if cfg.Exporter.Prometheus.TLS.ClientCAFile != "/etc/ca.pem" {
+					t.Errorf("env not applied: %+v", cfg.Exporter.Prometheus.TLS)
+				}
+			},
+		},
+		{
+			name: "nil pointer is allocated",
+			prepare: func(cfg *MetricsConfig) {
+				cfg.Exporter.Statsd = nil
+			},
+			env: map[string]string{
+				"VENUS_METRICS_EXPORTER_STATSD_ADDRESS": "127.0.0.1:9125",
+			},
+			check: func(t *testing.T, cfg *MetricsConfig) {
+				if cfg.Exporter.Statsd == nil || cfg.Exporter.Statsd.Address != "127.0.0.1:9125" {
+					t.Errorf("env not applied: %+v", cfg.Exporter.Statsd)
+				}
+			},
+		},
+		{
+			name: "invalid bool",
+			env:  map[string]string{"VENUS_METRICS_ENABLED": "yes please"},
+			err:  true,
+		},
+		{
+			name: "invalid map",
+			env:  map[string]string{"VENUS_METRICS_EXPORTER_PUSHGATEWAY_GROUPING": "miner"},
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for k, v := range c.env {
+				t.Setenv(k, v)
+			}
+			cfg := DefaultMetricsConfig()
+			if c.prepare != nil {
+				c.prepare(cfg)
+			}
+
+			err := ApplyEnv("VENUS_METRICS", cfg)
+			if c.err {
+				if err == nil {
+					t.Fatal("expect error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.check(t, cfg)
+		})
+	}
+}
+
+func TestBindFlags(t *testing.T) {
+	cases := []struct {
+		name  string
+		args  []string
+		check func(t *testing.T, cfg *TraceConfig)
+	}{
+		{
+			name: "no flags keep the config",
+			check: func(t *testing.T, cfg *TraceConfig) {
+				if !reflect.DeepEqual(cfg, newOverlayTraceConfig()) {
+					t.Errorf("config changed: %+v", cfg)
+				}
+			},
+		},
+		{
+			name: "bool flag without value",
+			args: []string{"--trace-tracing-enabled", "--trace-probability-sampler=0.25"},
+			check: func(t *testing.T, cfg *TraceConfig) {
+				if !cfg.TracingEnabled || cfg.ProbabilitySampler != 0.25 {
+					t.Errorf("flags not applied: %+v", cfg)
+				}
+				if cfg.ZipkinEndpoint != "http://zipkin:9411/api/v2/spans" {
+					t.Errorf("the value from the config file is overridden: %s", cfg.ZipkinEndpoint)
+				}
+			},
+		},
+		{
+			name: "nested and list",
+			args: []string{"--trace-otlp-endpoint", "collector:4317", "--trace-propagators", "b3,jaeger"},
+			check: func(t *testing.T, cfg *TraceConfig) {
+				if cfg.OTLP.Endpoint != "collector:4317" {
+					t.Errorf("expect otlp endpoint collector:4317, got %s", cfg.OTLP.Endpoint)
+				}
+				if want := []string{"b3", "jaeger"}; !reflect.DeepEqual(cfg.Propagators, want) {
+					t.Errorf("expect propagators %v, got %v", want, cfg.Propagators)
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := newOverlayTraceConfig()
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			if err := BindFlags(fs, "trace", cfg); err != nil {
+				t.Fatal(err)
+			}
+			if err := fs.Parse(c.args); err != nil {
+				t.Fatal(err)
+			}
+			c.check(t, cfg)
+		})
+	}
+}
+
+// newOverlayTraceConfig is the config loaded from the file before the flags
+func newOverlayTraceConfig() *TraceConfig {
+	cfg := DefaultTraceConfig()
+	cfg.ZipkinEndpoint = "http://zipkin:9411/api/v2/spans"
+	return cfg
+}
+
+func TestBindFlagsInvalidValue(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := BindFlags(fs, "metrics", DefaultMetricsConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Parse([]string{"--metrics-exporter-graphite-port=abc"}); err == nil {
+		t.Fatal("expect error of the invalid port")
+	}
+}
+
+func TestBindFlagsHideSecrets(t *testing.T) {
+	traceCfg := newOverlayTraceConfig()
+	traceCfg.JaegerPassword = "secret-jaeger"
+	metricsCfg := DefaultMetricsConfig()
+	metricsCfg.Exporter.Prometheus.BearerToken = "secret-bearer"
+	metricsCfg.Exporter.Prometheus.BasicAuthUsers = map[string]string{"admin": "secret-hash"}
+	metricsCfg.Exporter.Pushgateway.Password = "secret-password"
+	metricsCfg.Exporter.InfluxDB.Token = "secret-token"
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := BindFlags(fs, "trace", traceCfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := BindFlags(fs, "metrics", metricsCfg); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	fs.PrintDefaults()
+
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("the secrets are printed:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), traceCfg.ZipkinEndpoint) {
+		t.Errorf("expect the default %s to be printed", traceCfg.ZipkinEndpoint)
+	}
+
+	if err := fs.Parse([]string{"--trace-jaeger-password=changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if traceCfg.JaegerPassword != "changed" {
+		t.Errorf("expect the secret to be set by the flag, got %s", traceCfg.JaegerPassword)
+	}
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/prometheus"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// RegisterPushgatewayExporter register the pushgateway exporter, the metrics
+// collected by opencensus are pushed to the pushgateway every push interval, and
+// once more when `ctx` is done. It fits the short-lived jobs, which may exit
+// before being scraped.
+func RegisterPushgatewayExporter(ctx context.Context, cfg *MetricsPushgatewayExporterConfig) error {
+	e, err := newPushgatewayExporter(cfg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Info("context done")
+
+		if err := e.Shutdown(context.TODO()); err != nil {
+			log.Errorf("shutting down pushgateway exporter failed: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+type pushgatewayExporter struct {
+	pusher           *push.Pusher
+	deleteOnShutdown bool
+
+	stop chan struct{}
+	done chan struct{}
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+func newPushgatewayExporter(cfg *MetricsPushgatewayExporterConfig) (*pushgatewayExporter, error) {
+	pushInterval, err := time.ParseDuration(cfg.PushInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	// the pushgateway always uses its own registry, so it does not conflict
+	// with the prometheus exporter
+	registry := promclient.NewRegistry()
+	if _, err := prometheus.NewExporter(prometheus.Options{
+		Namespace: cfg.Namespace,
+		Registry:  registry,
+	}); err != nil {
+		return nil, fmt.Errorf("could not create the prometheus stats exporter: %w", err)
+	}
+	if err := registry.Register(&summaryCollector{namespace: cfg.Namespace}); err != nil {
+		return nil, fmt.Errorf("could not register the summary collector: %w", err)
+	}
+
+	pusher := push.New(cfg.URL, cfg.Job).Gatherer(registry)
+	if cfg.Instance != "" {
+		pusher = pusher.Grouping("instance", cfg.Instance)
+	}
+	for name, value := range cfg.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if cfg.Username != "" {
+		pusher = pusher.BasicAuth(cfg.Username, cfg.Password)
+	}
+	if err := pusher.Error(); err != nil {
+		return nil, err
+	}
+
+	e := &pushgatewayExporter{
+		pusher:           pusher,
+		deleteOnShutdown: cfg.DeleteOnShutdown,
+		stop:             make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+
+	go e.loop(pushInterval)
+
+	log.Infof("Start pushgateway exporter, push to %s every %s", cfg.URL, pushInterval)
+	return e, nil
+}
+
+func (e *pushgatewayExporter) loop(pushInterval time.Duration) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(pushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.pusher.Push(); err != nil {
+				log.Warnf("push metrics to pushgateway failed: %s", err)
+			}
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Shutdown pushes the metrics for the last time, and deletes them from the
+// pushgateway if DeleteOnShutdown is set, so the metrics of the finished job
+// are not exposed forever. The metrics are deleted even if the last push fails,
+// and the calls after the first one return the same error.
+func (e *pushgatewayExporter) Shutdown(ctx context.Context) error {
+	e.shutdownOnce.Do(func() {
+		close(e.stop)
+		<-e.done
+
+		var errs []error
+		if err := e.pusher.PushContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("push metrics: %w", err))
+		}
+		if e.deleteOnShutdown {
+			if err := e.pusher.Delete(); err != nil {
+				errs = append(errs, fmt.Errorf("delete metrics: %w", err))
+			}
+		}
+		e.shutdownErr = errors.Join(errs...)
+	})
+	return e.shutdownErr
+}
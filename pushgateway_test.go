@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"go.opencensus.io/stats/view"
+)
+
+type pushgatewayRequest struct {
+	method   string
+	grouping map[string]string
+	username string
+	password string
+	families map[string]*dto.MetricFamily
+}
+
+// fakePushgateway records the requests, the pushes are answered with
+// `pushStatus`
+type fakePushgateway struct {
+	t          *testing.T
+	pushStatus int
+
+	mux      sync.Mutex
+	requests []pushgatewayRequest
+}
+
+func (p *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := pushgatewayRequest{
+		method:   r.Method,
+		grouping: parsePushgatewayPath(p.t, r.URL.Path),
+		families: make(map[string]*dto.MetricFamily),
+	}
+	req.username, req.password, _ = r.BasicAuth()
+
+	status := http.StatusAccepted
+	if r.Method != http.MethodDelete {
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			mf := &dto.MetricFamily{}
+			if err := dec.Decode(mf); err != nil {
+				if err != io.EOF {
+					p.t.Errorf("decode pushed metrics: %s", err)
+				}
+				break
+			}
+			req.families[mf.GetName()] = mf
+		}
+		status = p.pushStatus
+	}
+
+	p.mux.Lock()
+	p.requests = append(p.requests, req)
+	p.mux.Unlock()
+	w.WriteHeader(status)
+}
+
+func (p *fakePushgateway) recorded() []pushgatewayRequest {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return append([]pushgatewayRequest(nil), p.requests...)
+}
+
+// parsePushgatewayPath parses `/metrics/job/<job>/<label>/<value>...`, the order
+// of the grouping labels is not fixed.
+func parsePushgatewayPath(t *testing.T, path string) map[string]string {
+	parts := strings.Split(strings.TrimPrefix(path, "/metrics/"), "/")
+	if len(parts)%2 != 0 {
+		t.Errorf("unexpected pushgateway path %s", path)
+		return nil
+	}
+	grouping := make(map[string]string)
+	for i := 0; i < len(parts); i += 2 {
+		grouping[parts[i]] = parts[i+1]
+	}
+	return grouping
+}
+
+func newTestPushgatewayConfig(url string) *MetricsPushgatewayExporterConfig {
+	cfg := newMetricsPushgatewayExporterConfig()
+	cfg.URL = url
+	cfg.Job = "sealer"
+	cfg.Instance = "worker-1"
+	cfg.Grouping = map[string]string{"miner": "f01000"}
+	cfg.Username = "user"
+	cfg.Password = "secret"
+	// only the push on shutdown is tested
+	cfg.PushInterval = "1h"
+	cfg.DeleteOnShutdown = true
+	return cfg
+}
+
+func TestPushgatewayExporter(t *testing.T) {
+	gauge, err := TryNewInt64("pushgateway_test_gauge", "gauge pushed to the pushgateway", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gauge.Set(context.Background(), 42)
+	// the values are recorded by the view worker asynchronously, retrieving
+	// the data waits for the recorded value
+	if _, err := view.RetrieveData("pushgateway_test_gauge"); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := &fakePushgateway{t: t, pushStatus: http.StatusOK}
+	srv := httptest.NewServer(gw)
+	defer srv.Close()
+
+	e, err := newPushgatewayExporter(newTestPushgatewayConfig(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := gw.recorded()
+	if len(requests) != 2 {
+		t.Fatalf("expect a push and a delete, got %d requests", len(requests))
+	}
+	wantGrouping := map[string]string{"job": "sealer", "instance": "worker-1", "miner": "f01000"}
+	for i, method := range []string{http.MethodPut, http.MethodDelete} {
+		req := requests[i]
+		if req.method != method {
+			t.Errorf("request %d: expect %s, got %s", i, method, req.method)
+		}
+		if len(req.grouping) != len(wantGrouping) {
+			t.Errorf("request %d: expect grouping %v, got %v", i, wantGrouping, req.grouping)
+		}
+		for k, v := range wantGrouping {
+			if req.grouping[k] != v {
+				t.Errorf("request %d: expect grouping %v, got %v", i, wantGrouping, req.grouping)
+			}
+		}
+		if req.username != "user" || req.password != "secret" {
+			t.Errorf("request %d: unexpected basic auth %s:%s", i, req.username, req.password)
+		}
+	}
+
+	mf, ok := requests[0].families["pushgateway_test_gauge"]
+	if !ok {
+		t.Fatal("pushgateway_test_gauge is not pushed")
+	}
+	if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 42 {
+		t.Errorf("expect pushed value 42, got %v", got)
+	}
+}
+
+func TestPushgatewayExporterDeleteAfterFailedPush(t *testing.T) {
+	gw := &fakePushgateway{t: t, pushStatus: http.StatusInternalServerError}
+	srv := httptest.NewServer(gw)
+	defer srv.Close()
+
+	e, err := newPushgatewayExporter(newTestPushgatewayConfig(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.Shutdown(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "push metrics") {
+		t.Fatalf("expect the push error, got %v", err)
+	}
+
+	requests := gw.recorded()
+	if len(requests) != 2 || requests[1].method != http.MethodDelete {
+		t.Fatalf("expect the metrics deleted after the failed push, got %d requests", len(requests))
+	}
+
+	// shutting down again does not panic or push again
+	if err2 := e.Shutdown(context.Background()); err2 != err {
+		t.Errorf("expect the same error, got %v", err2)
+	}
+	if len(gw.recorded()) != 2 {
+		t.Errorf("expect no more requests after the second shutdown")
+	}
+}
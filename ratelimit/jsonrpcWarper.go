@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/ipfs-force-community/metrics/tracing"
 	"go.opencensus.io/trace"
 )
 
@@ -17,7 +18,7 @@ func (h *RateLimiter) CallProxy(fname string, fn reflect.Value, args []reflect.V
 
 	span := trace.FromContext(ctx)
 	if span == nil {
-		ctx, span = trace.StartSpan(ctx, "api.handle")
+		ctx, span = tracing.StartSpan(ctx, "api.handle")
 		args[0] = reflect.ValueOf(ctx)
 		defer span.End()
 	}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// metricDefinition is what a metric is declared with, the metric declared again
+// with the same definition is the registered one.
+type metricDefinition struct {
+	// kind is the type of the metric, like `Int64` or `Float64Timer`
+	kind        string
+	description string
+	unit        string
+	aggregation string
+	tags        []string
+	// unique metrics can not be declared again, like the observable gauges whose
+	// callbacks can not be compared
+	unique bool
+}
+
+func newMetricDefinition(kind, desc, unit, aggregation string, keys []tag.Key) metricDefinition {
+	tags := make([]string, len(keys))
+	for i, k := range keys {
+		tags[i] = k.Name()
+	}
+	// the order of the tags does not matter, the views sort them too
+	sort.Strings(tags)
+	return metricDefinition{
+		kind:        kind,
+		description: desc,
+		unit:        unit,
+		aggregation: aggregation,
+		tags:        tags,
+	}
+}
+
+// diff describes the differences between the definitions
+func (d metricDefinition) diff(o metricDefinition) []string {
+	var diff []string
+	if d.kind != o.kind {
+		diff = append(diff, fmt.Sprintf("type %s != %s", d.kind, o.kind))
+	}
+	if d.description != o.description {
+		diff = append(diff, fmt.Sprintf("description %q != %q", d.description, o.description))
+	}
+	if d.unit != o.unit {
+		diff = append(diff, fmt.Sprintf("unit %q != %q", d.unit, o.unit))
+	}
+	if d.aggregation != o.aggregation {
+		diff = append(diff, fmt.Sprintf("aggregation %s != %s", d.aggregation, o.aggregation))
+	}
+	if strings.Join(d.tags, ",") != strings.Join(o.tags, ",") {
+		diff = append(diff, fmt.Sprintf("tags %v != %v", d.tags, o.tags))
+	}
+	return diff
+}
+
+func aggregationName(agg *view.Aggregation) string {
+	if agg.Type == view.AggTypeDistribution {
+		bounds := append([]float64(nil), agg.Buckets...)
+		sort.Float64s(bounds)
+		return fmt.Sprintf("%s%v", agg.Type, bounds)
+	}
+	return agg.Type.String()
+}
+
+func summaryAggregationName(quantiles []float64, maxAge time.Duration) string {
+	qs := append([]float64(nil), quantiles...)
+	sort.Float64s(qs)
+	return fmt.Sprintf("Summary%v/%s", qs, maxAge)
+}
+
+type registeredMetric struct {
+	def    metricDefinition
+	metric interface{}
+}
+
+// metricRegistry keeps the metrics created by the constructors by their exported
+// names, so the metric declared by several packages or tests is created once.
+type metricRegistry struct {
+	mux     sync.Mutex
+	metrics map[string]registeredMetric
+}
+
+var registered = &metricRegistry{metrics: make(map[string]registeredMetric)}
+
+// register returns the metric `name` if it is registered with `def`, otherwise
+// it is created by `create` and registered.
+func (r *metricRegistry) register(name string, def metricDefinition, create func() (interface{}, error)) (interface{}, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if m, ok := r.metrics[name]; ok {
+		if diff := m.def.diff(def); len(diff) > 0 {
+			return nil, fmt.Errorf("metric %s is already registered with a different definition: %s", name, strings.Join(diff, ", "))
+		}
+		if def.unique {
+			return nil, fmt.Errorf("%s %s is already registered", def.kind, name)
+		}
+		return m.metric, nil
+	}
+
+	metric, err := create()
+	if err != nil {
+		return nil, fmt.Errorf("could not register metric %s: %w", name, err)
+	}
+	r.metrics[name] = registeredMetric{def: def, metric: metric}
+	return metric, nil
+}
+
+// unregister removes the metric `name` if it is `metric`
+func (r *metricRegistry) unregister(name string, metric interface{}) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if m, ok := r.metrics[name]; ok && m.metric == metric {
+		delete(r.metrics, name)
+	}
+}
+
+// checkViewUnregistered returns an error if the view `name` is registered. The
+// metrics produced without views, like the summaries and the observable gauges,
+// are checked by the metric registry, but the views can be registered without
+// it, then both would be exported with the same name.
+func checkViewUnregistered(name string) error {
+	if view.Find(name) != nil {
+		return fmt.Errorf("metric %s is already registered", name)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opencensus.io/tag"
+)
+
+func TestRegistryRedeclare(t *testing.T) {
+	keyA, keyB := tag.MustNewKey("registry_a"), tag.MustNewKey("registry_b")
+
+	cases := []struct {
+		name string
+		// first declares the metric, second declares it again
+		first  func() (interface{}, error)
+		second func() (interface{}, error)
+		// want is the substring of the error of the second declaration, empty
+		// if the registered metric is returned
+		want string
+	}{
+		{
+			name:   "same definition",
+			first:  func() (interface{}, error) { return TryNewInt64("registry_same", "d", "") },
+			second: func() (interface{}, error) { return TryNewInt64("registry_same", "d", "") },
+		},
+		{
+			name:   "tags in another order",
+			first:  func() (interface{}, error) { return TryNewInt64("registry_tags_order", "d", "", keyA, keyB) },
+			second: func() (interface{}, error) { return TryNewInt64("registry_tags_order", "d", "", keyB, keyA) },
+		},
+		{
+			name:   "empty unit is dimensionless",
+			first:  func() (interface{}, error) { return TryNewFloat64("registry_unit", "d", "") },
+			second: func() (interface{}, error) { return TryNewFloat64("registry_unit", "d", "1") },
+		},
+		{
+			name:   "different description",
+			first:  func() (interface{}, error) { return TryNewInt64("registry_desc", "d", "") },
+			second: func() (interface{}, error) { return TryNewInt64("registry_desc", "other", "") },
+			want:   `description "d" != "other"`,
+		},
+		{
+			name:   "different unit",
+			first:  func() (interface{}, error) { return TryNewFloat64("registry_diff_unit", "d", "By") },
+			second: func() (interface{}, error) { return TryNewFloat64("registry_diff_unit", "d", "ms") },
+			want:   `unit "By" != "ms"`,
+		},
+		{
+			name:   "different tags",
+			first:  func() (interface{}, error) { return TryNewInt64("registry_diff_tags", "d", "", keyA) },
+			second: func() (interface{}, error) { return TryNewInt64("registry_diff_tags", "d", "", keyB) },
+			want:   "tags [registry_a] != [registry_b]",
+		},
+		{
+			name:   "different type",
+			first:  func() (interface{}, error) { return TryNewInt64("registry_type", "d", "") },
+			second: func() (interface{}, error) { return TryNewFloat64("registry_type", "d", "") },
+			want:   "type Int64 != Float64",
+		},
+		{
+			name: "different buckets",
+			first: func() (interface{}, error) {
+				return TryNewTimerMs("registry_buckets", "d", keyA)
+			},
+			second: func() (interface{}, error) {
+				return TryNewTimerWithBuckets("registry_buckets", "d", "ms", []float64{1, 2}, keyA)
+			},
+			want: "aggregation",
+		},
+		{
+			name: "observable gauge",
+			first: func() (interface{}, error) {
+				return TryNewInt64ObservableGauge("registry_observable", "d", "", func(context.Context, *Int64Observer) {})
+			},
+			second: func() (interface{}, error) {
+				return TryNewInt64ObservableGauge("registry_observable", "d", "", func(context.Context, *Int64Observer) {})
+			},
+			want: "Int64ObservableGauge registry_observable is already registered",
+		},
+		{
+			name: "observable gauge and view",
+			first: func() (interface{}, error) {
+				return TryNewFloat64ObservableGauge("registry_observable_view", "d", "", func(context.Context, *Float64Observer) {})
+			},
+			second: func() (interface{}, error) { return TryNewFloat64("registry_observable_view", "d", "") },
+			want:   "type Float64ObservableGauge != Float64",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			first, err := c.first()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g, ok := first.(*ObservableGauge); ok {
+				// the gauges can not be declared again until unregistered
+				t.Cleanup(g.Unregister)
+			}
+			second, err := c.second()
+			if c.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if first != second {
+					t.Errorf("expect the registered metric")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("expect %q in the error, got %v", c.want, err)
+			}
+		})
+	}
+}
+
+func TestRegistryUnregister(t *testing.T) {
+	observe := func(context.Context, *Int64Observer) {}
+	g, err := TryNewInt64ObservableGauge("registry_unregister", "d", "", observe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Unregister()
+
+	g, err = TryNewInt64ObservableGauge("registry_unregister", "d", "", observe)
+	if err != nil {
+		t.Fatalf("the unregistered gauge can be declared again: %s", err)
+	}
+	g.Unregister()
+}
+
+func TestSummarizerRedeclare(t *testing.T) {
+	first, err := TryNewInt64WithQuantiles("registry_summary", "d", "", DefaultQuantiles, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := TryNewInt64WithQuantiles("registry_summary", "d", "", []float64{0.99, 0.5, 0.9}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("the quantiles in another order should return the registered summary")
+	}
+
+	if _, err := TryNewInt64WithQuantiles("registry_summary", "d", "", DefaultQuantiles, time.Hour); err == nil {
+		t.Errorf("expect the error of the different max age")
+	}
+}
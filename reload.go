@@ -0,0 +1,234 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ConfigLoader loads the configs to apply on reload, a nil config is not applied.
+type ConfigLoader func() (*MetricsConfig, *TraceConfig, error)
+
+// Reloader applies the configs loaded by its ConfigLoader to the running
+// exporters and the tracer provider. The reload can be triggered by signals,
+// by the changes of the config file, or by the admin http endpoint.
+type Reloader struct {
+	load    ConfigLoader
+	metrics *MetricsHandle
+	tp      *tracesdk.TracerProvider
+
+	mux sync.Mutex
+}
+
+// NewReloader creates a Reloader, `metrics` or `tp` can be nil if it is not
+// set up. If `tp` is nil, the tracer provider is set up by SetupTracing once
+// the reloaded trace config enables tracing, see TracerProvider.
+func NewReloader(load ConfigLoader, metrics *MetricsHandle, tp *tracesdk.TracerProvider) *Reloader {
+	return &Reloader{
+		load:    load,
+		metrics: metrics,
+		tp:      tp,
+	}
+}
+
+// Reload loads the configs and applies them, the trace config is still applied
+// if the metrics config fails.
+func (r *Reloader) Reload(ctx context.Context) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	metricsCfg, traceCfg, err := r.load()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	var errs []error
+	if metricsCfg != nil && r.metrics != nil {
+		if err := r.metrics.Reload(ctx, metricsCfg); err != nil {
+			errs = append(errs, fmt.Errorf("reload metrics: %w", err))
+		}
+	}
+	if traceCfg != nil {
+		if err := r.reloadTracing(ctx, traceCfg); err != nil {
+			errs = append(errs, fmt.Errorf("reload tracing: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reloadTracing applies `cfg` to the tracer provider, which is set up if it is
+// nil and `cfg` enables tracing. The caller must hold r.mux.
+func (r *Reloader) reloadTracing(ctx context.Context, cfg *TraceConfig) error {
+	if r.tp != nil {
+		return ReloadTracing(ctx, r.tp, cfg)
+	}
+	if !cfg.TracingEnabled && !cfg.JaegerTracingEnabled {
+		return nil
+	}
+
+	tp, err := SetupTracing(cfg.ServerName, cfg)
+	if err != nil {
+		return err
+	}
+	r.tp = tp
+	log.Infof("tracing enabled by reload, exporter: %s", cfg.Exporter)
+	return nil
+}
+
+// TracerProvider returns the tracer provider the configs are applied to, it is
+// the one set up by the reload if NewReloader is given nil, so it can be shut
+// down with ShutdownTracing. It is nil if tracing is never enabled.
+func (r *Reloader) TracerProvider() *tracesdk.TracerProvider {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.tp
+}
+
+func (r *Reloader) reload(ctx context.Context) {
+	if err := r.Reload(ctx); err != nil {
+		log.Errorf("reload config failed: %s", err)
+	}
+}
+
+// WatchSignal reloads the configs on receiving the signals, SIGHUP by default,
+// until `ctx` is done.
+func (r *Reloader) WatchSignal(ctx context.Context, sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				log.Infof("received %s, reload config", sig)
+				r.reload(ctx)
+			}
+		}
+	}()
+}
+
+// reloadDebounce merges the events of a single save, editors often write a file
+// in several steps.
+const reloadDebounce = 100 * time.Millisecond
+
+// WatchFile reloads the configs when the file at `path` changes, until `ctx` is
+// done. The directory of the file is watched, and the file is resolved through
+// the symlinks on each event in it, so the file replaced by renaming, like
+// editors do, and the Kubernetes ConfigMap volumes, whose files are symlinks
+// switched to a new directory atomically, are detected too.
+func (r *Reloader) WatchFile(ctx context.Context, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create file watcher: %w", err)
+	}
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("watch %s: %w", path, err)
+	}
+
+	// the state is taken before returning, so the changes right after are
+	// detected
+	last := statConfigFile(path)
+	go func() {
+		defer w.Close() //nolint:errcheck
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				written := filepath.Clean(ev.Name) == path && ev.Op&(fsnotify.Write|fsnotify.Create) != 0
+				// the symlinks of a config map point to the new files, while
+				// the events are about the entries of the directory
+				current := statConfigFile(path)
+				changed := current != last
+				last = current
+				if current == (configFileState{}) || !written && !changed {
+					// the file being replaced is reloaded once it exists
+					continue
+				}
+				debounce = time.After(reloadDebounce)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("watch config file %s: %s", path, err)
+			case <-debounce:
+				debounce = nil
+				log.Infof("config file %s changed, reload config", path)
+				r.reload(ctx)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// configFileState identifies the content of the config file by the real file it
+// resolves to and its modification
+type configFileState struct {
+	target  string
+	modTime time.Time
+	size    int64
+}
+
+// statConfigFile returns the zero state if the file does not exist, e.g. it is
+// being replaced
+func statConfigFile(path string) configFileState {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return configFileState{}
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return configFileState{}
+	}
+	return configFileState{
+		target:  target,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+}
+
+// ServeHTTP reloads the configs on POST requests. It has no authentication, so
+// it should only be mounted on an admin endpoint.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the exporters started by the reload outlive the request
+	if err := r.Reload(context.WithoutCancel(req.Context())); err != nil {
+		log.Errorf("reload config failed: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write([]byte("reloaded\n"))
+}
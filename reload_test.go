@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// countingLoader counts the loads, and returns no config to apply
+func countingLoader(n *atomic.Int32) ConfigLoader {
+	return func() (*MetricsConfig, *TraceConfig, error) {
+		n.Add(1)
+		return nil, nil, nil
+	}
+}
+
+func waitLoads(t *testing.T, n *atomic.Int32, want int32) {
+	deadline := time.Now().Add(5 * time.Second)
+	for n.Load() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d loads, got %d", want, n.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloaderServeHTTP(t *testing.T) {
+	ctx := context.Background()
+	h, err := SetupMetrics(ctx, DefaultMetricsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Shutdown(ctx) //nolint:errcheck
+
+	var loadErr error
+	cfg := newTestPrometheusConfig()
+	r := NewReloader(func() (*MetricsConfig, *TraceConfig, error) {
+		return cfg, nil, loadErr
+	}, h, nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("expect 405, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if h.Addr() == nil {
+		t.Fatal("expect the prometheus exporter to be started by the reload")
+	}
+
+	loadErr = errors.New("broken file")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reload", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expect 500, got %d", rec.Code)
+	}
+	if h.Addr() == nil {
+		t.Error("expect the exporters to keep running")
+	}
+}
+
+// the tracer provider is set up once the reloaded config enables tracing
+func TestReloaderEnableTracing(t *testing.T) {
+	cfg := DefaultTraceConfig()
+	r := NewReloader(func() (*MetricsConfig, *TraceConfig, error) {
+		return nil, cfg, nil
+	}, nil, nil)
+
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if r.TracerProvider() != nil {
+		t.Fatal("expect tracing to be disabled")
+	}
+
+	cfg = DefaultTraceConfig()
+	cfg.TracingEnabled = true
+	cfg.Exporter = TETZipkin
+	cfg.ZipkinEndpoint = "http://127.0.0.1:9411/api/v2/spans"
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tp := r.TracerProvider()
+	if tp == nil {
+		t.Fatal("expect the tracer provider to be set up")
+	}
+	if err := ShutdownTracing(context.Background(), tp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloaderWatchSignal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var loads atomic.Int32
+	r := NewReloader(countingLoader(&loads), nil, nil)
+	r.WatchSignal(ctx, syscall.SIGUSR1)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	waitLoads(t, &loads, 1)
+}
+
+func TestReloaderWatchFile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var loads atomic.Int32
+	r := NewReloader(countingLoader(&loads), nil, nil)
+	if err := r.WatchFile(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// the other files in the directory are ignored
+	if err := os.WriteFile(filepath.Join(dir, "other.toml"), []byte("v1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("v2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitLoads(t, &loads, 1)
+
+	// the file replaced by renaming, like the editors do
+	tmp := filepath.Join(dir, "config.toml.tmp")
+	if err := os.WriteFile(tmp, []byte("v3 of another size"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	waitLoads(t, &loads, 2)
+
+	// the writes of a single save are debounced
+	time.Sleep(2 * reloadDebounce)
+	if n := loads.Load(); n != 2 {
+		t.Errorf("expect 2 loads, got %d", n)
+	}
+}
+
+// the symlinks of the Kubernetes ConfigMap volumes are switched to the new
+// directory atomically
+func TestReloaderWatchFileSymlink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		if err := os.Mkdir(filepath.Join(dir, version), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, version, "config.toml"), []byte(version), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.toml")
+	if err := os.Symlink(filepath.Join("..data", "config.toml"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	var loads atomic.Int32
+	r := NewReloader(countingLoader(&loads), nil, nil)
+	if err := r.WatchFile(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink("v2", tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	waitLoads(t, &loads, 1)
+}
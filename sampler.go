@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+type SamplerType string
+
+const (
+	STAlwaysOn     SamplerType = "always_on"
+	STAlwaysOff    SamplerType = "always_off"
+	STRatio        SamplerType = "ratio"
+	STRateLimiting SamplerType = "rate_limiting"
+)
+
+// newSampler builds the sampler configured by `cfg.Sampler`, spans matching one of
+// the rules are sampled by the sampler of the rule, and the others fall back to the
+// sampler of `cfg.Sampler.Type`. If `ParentBased` is set, the rules and the fallback
+// only decide for the root spans, the child spans follow the decision of their
+// parent, so a rule does not drop a part of a sampled trace.
+// Without `cfg.Sampler` spans are sampled by the ratio of `cfg.ProbabilitySampler`.
+func newSampler(cfg *TraceConfig) (tracesdk.Sampler, error) {
+	if cfg.Sampler == nil {
+		return tracesdk.TraceIDRatioBased(cfg.ProbabilitySampler), nil
+	}
+
+	root, err := newTypedSampler(cfg.Sampler.Type, cfg.ProbabilitySampler, cfg.Sampler.RatePerSecond)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Sampler.Rules) > 0 {
+		rs := &ruleSampler{
+			rules:    make([]*samplerRule, 0, len(cfg.Sampler.Rules)),
+			fallback: root,
+		}
+		for _, r := range cfg.Sampler.Rules {
+			sampler, err := newTypedSampler(r.Type, r.Ratio, r.RatePerSecond)
+			if err != nil {
+				return nil, fmt.Errorf("sampler rule for span %s: %w", r.SpanName, err)
+			}
+			rs.rules = append(rs.rules, &samplerRule{
+				spanName:   r.SpanName,
+				attributes: r.Attributes,
+				sampler:    sampler,
+			})
+		}
+		root = rs
+	}
+	if cfg.Sampler.ParentBased {
+		root = tracesdk.ParentBased(root)
+	}
+	return root, nil
+}
+
+func newTypedSampler(t SamplerType, ratio, ratePerSecond float64) (tracesdk.Sampler, error) {
+	switch t {
+	case STAlwaysOn:
+		return tracesdk.AlwaysSample(), nil
+	case STAlwaysOff:
+		return tracesdk.NeverSample(), nil
+	case STRatio, "":
+		return tracesdk.TraceIDRatioBased(ratio), nil
+	case STRateLimiting:
+		return newRateLimitingSampler(ratePerSecond), nil
+	default:
+		return nil, fmt.Errorf("wrong sampler type: %s", t)
+	}
+}
+
+// rateLimitingSampler samples at most `ratePerSecond` spans per second.
+type rateLimitingSampler struct {
+	ratePerSecond float64
+	limiter       *rate.Limiter
+}
+
+func newRateLimitingSampler(ratePerSecond float64) *rateLimitingSampler {
+	burst := int(ratePerSecond)
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimitingSampler{
+		ratePerSecond: ratePerSecond,
+		limiter:       rate.NewLimiter(rate.Limit(ratePerSecond), burst),
+	}
+}
+
+func (s *rateLimitingSampler) ShouldSample(p tracesdk.SamplingParameters) tracesdk.SamplingResult {
+	decision := tracesdk.Drop
+	if s.limiter.Allow() {
+		decision = tracesdk.RecordAndSample
+	}
+	return tracesdk.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", s.ratePerSecond)
+}
+
+type samplerRule struct {
+	spanName   string
+	attributes map[string]string
+	sampler    tracesdk.Sampler
+}
+
+// match reports whether the span matches the rule, the span name matches exactly
+// or by prefix if the rule ends with `*`. Only the attributes given when the span
+// starts are visible here.
+func (r *samplerRule) match(p tracesdk.SamplingParameters) bool {
+	if prefix, ok := strings.CutSuffix(r.spanName, "*"); ok {
+		if !strings.HasPrefix(p.Name, prefix) {
+			return false
+		}
+	} else if r.spanName != p.Name {
+		return false
+	}
+
+	for k, v := range r.attributes {
+		if !hasAttribute(p.Attributes, k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAttribute(attrs []attribute.KeyValue, key, value string) bool {
+	for _, kv := range attrs {
+		if string(kv.Key) == key && kv.Value.Emit() == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleSampler samples spans by the first matching rule, the other spans are
+// sampled by the fallback sampler.
+type ruleSampler struct {
+	rules    []*samplerRule
+	fallback tracesdk.Sampler
+}
+
+func (s *ruleSampler) ShouldSample(p tracesdk.SamplingParameters) tracesdk.SamplingResult {
+	for _, r := range s.rules {
+		if r.match(p) {
+			return r.sampler.ShouldSample(p)
+		}
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *ruleSampler) Description() string {
+	descs := make([]string, 0, len(s.rules))
+	for _, r := range s.rules {
+		descs = append(descs, fmt.Sprintf("%s:%s", r.spanName, r.sampler.Description()))
+	}
+	return fmt.Sprintf("RuleSampler{rules:[%s],fallback:%s}", strings.Join(descs, ","), s.fallback.Description())
+}
+
+// reloadableSampler delegates to a sampler which can be replaced at runtime, so
+// the sampling of the tracer provider changes without recreating it.
+type reloadableSampler struct {
+	sampler atomic.Value // tracesdk.Sampler
+}
+
+func newReloadableSampler(sampler tracesdk.Sampler) *reloadableSampler {
+	s := &reloadableSampler{}
+	s.set(sampler)
+	return s
+}
+
+func (s *reloadableSampler) set(sampler tracesdk.Sampler) {
+	s.sampler.Store(samplerHolder{sampler})
+}
+
+func (s *reloadableSampler) get() tracesdk.Sampler {
+	return s.sampler.Load().(samplerHolder).Sampler
+}
+
+func (s *reloadableSampler) ShouldSample(p tracesdk.SamplingParameters) tracesdk.SamplingResult {
+	return s.get().ShouldSample(p)
+}
+
+func (s *reloadableSampler) Description() string {
+	return s.get().Description()
+}
+
+// samplerHolder keeps the concrete type stored in atomic.Value the same
+type samplerHolder struct {
+	tracesdk.Sampler
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSamplerRules(t *testing.T) {
+	rules := []*TraceSamplerRule{
+		{SpanName: "HTTP POST", Attributes: map[string]string{"http.target": "/rpc/v1"}, Type: STAlwaysOn},
+		{SpanName: "HTTP GET*", Type: STAlwaysOn},
+	}
+	rpc := []attribute.KeyValue{attribute.String("http.method", "POST"), attribute.String("http.target", "/rpc/v1")}
+
+	cases := []struct {
+		name        string
+		parentBased bool
+		// parent is the sampling decision of the parent span, nil for the root spans
+		parent *bool
+		remote bool
+		span   string
+		attrs  []attribute.KeyValue
+		want   tracesdk.SamplingDecision
+	}{
+		{
+			name:  "root span matching the rule",
+			span:  "HTTP POST",
+			attrs: rpc,
+			want:  tracesdk.RecordAndSample,
+		},
+		{
+			name: "root span without the attributes of the rule",
+			span: "HTTP POST",
+			want: tracesdk.Drop,
+		},
+		{
+			name: "root span matching the prefix",
+			span: "HTTP GET /healthz",
+			want: tracesdk.RecordAndSample,
+		},
+		{
+			name:        "parent based root span matching the rule",
+			parentBased: true,
+			span:        "HTTP POST",
+			attrs:       rpc,
+			want:        tracesdk.RecordAndSample,
+		},
+		{
+			name:        "parent based root span falls back",
+			parentBased: true,
+			span:        "HTTP PUT",
+			want:        tracesdk.Drop,
+		},
+		{
+			name:        "parent based child of dropped remote parent ignores the rules",
+			parentBased: true,
+			parent:      newBool(false),
+			remote:      true,
+			span:        "HTTP POST",
+			attrs:       rpc,
+			want:        tracesdk.Drop,
+		},
+		{
+			name:        "parent based child of sampled local parent ignores the rules",
+			parentBased: true,
+			parent:      newBool(true),
+			span:        "HTTP PUT",
+			want:        tracesdk.RecordAndSample,
+		},
+		{
+			name:   "child of dropped parent matching the rule",
+			parent: newBool(false),
+			span:   "HTTP POST",
+			attrs:  rpc,
+			want:   tracesdk.RecordAndSample,
+		},
+		{
+			name:   "child of sampled parent falls back",
+			parent: newBool(true),
+			span:   "HTTP PUT",
+			want:   tracesdk.Drop,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultTraceConfig()
+			// the spans not matching the rules are dropped
+			cfg.ProbabilitySampler = 0
+			cfg.Sampler = &TraceSamplerConfig{Type: STRatio, ParentBased: c.parentBased, Rules: rules}
+			sampler, err := newSampler(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if c.parent != nil {
+				sc := trace.SpanContextConfig{
+					TraceID: trace.TraceID{1},
+					SpanID:  trace.SpanID{1},
+					Remote:  c.remote,
+				}
+				if *c.parent {
+					sc.TraceFlags = trace.FlagsSampled
+				}
+				ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(sc))
+			}
+			got := sampler.ShouldSample(tracesdk.SamplingParameters{
+				ParentContext: ctx,
+				TraceID:       trace.TraceID{1},
+				Name:          c.span,
+				Attributes:    c.attrs,
+			})
+			if got.Decision != c.want {
+				t.Errorf("expect decision %v, got %v", c.want, got.Decision)
+			}
+		})
+	}
+}
+
+func newBool(b bool) *bool {
+	return &b
+}
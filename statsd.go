@@ -0,0 +1,315 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricexport"
+)
+
+// RegisterStatsdExporter register the statsd exporter, the views are sent to the
+// statsd agent every reporting period, counters are sent as the increments since
+// the last report, last values as gauges and distributions as timers sampled
+// once per bucket. The summaries are sent as the gauges of their quantiles.
+func RegisterStatsdExporter(ctx context.Context, cfg *MetricsStatsdExporterConfig) error {
+	e, err := newStatsdExporter(cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Info("context done")
+
+		if err := e.Shutdown(context.TODO()); err != nil {
+			log.Errorf("shutting down statsd exporter failed: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+type statsdExporter struct {
+	namespace     string
+	dogStatsD     bool
+	maxPacketSize int
+
+	conn   net.Conn
+	reader *metricexport.IntervalReader
+
+	// the last values of the cumulative series, counters are sent as increments
+	sent *cumulativeValues
+}
+
+// cumulativeValues are the last values of the cumulative series sent to statsd.
+// They are handed over to the exporter replacing this one on reload, otherwise
+// its first report would send the whole values as increments again.
+type cumulativeValues struct {
+	mux  sync.Mutex
+	last map[string]cumulativeValue
+}
+
+func newCumulativeValues() *cumulativeValues {
+	return &cumulativeValues{last: make(map[string]cumulativeValue)}
+}
+
+type cumulativeValue struct {
+	count   int64
+	sum     float64
+	buckets []int64
+}
+
+// newStatsdExporter starts the statsd exporter, `sent` are the values sent by
+// the exporter it replaces, nil if there is none.
+func newStatsdExporter(cfg *MetricsStatsdExporterConfig, sent *cumulativeValues) (*statsdExporter, error) {
+	switch cfg.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+	default:
+		return nil, fmt.Errorf("unsupported statsd network: %s", cfg.Network)
+	}
+
+	conn, err := net.Dial(cfg.Network, cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not dial statsd: %w", err)
+	}
+
+	if sent == nil {
+		sent = newCumulativeValues()
+	}
+	e := &statsdExporter{
+		namespace:     cfg.Namespace,
+		dogStatsD:     cfg.DogStatsD,
+		maxPacketSize: cfg.MaxPacketSize,
+		conn:          conn,
+		sent:          sent,
+	}
+	e.reader, err = startIntervalReader(e, cfg.ReportingPeriod)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	log.Infof("Start statsd exporter, send to %s://%s", cfg.Network, cfg.Address)
+	return e, nil
+}
+
+// Shutdown sends the metrics for the last time and closes the connection
+func (e *statsdExporter) Shutdown(_ context.Context) error {
+	e.reader.Stop()
+	e.reader.Flush()
+	return e.conn.Close()
+}
+
+// ExportMetrics implements metricexport.Exporter
+func (e *statsdExporter) ExportMetrics(_ context.Context, metrics []*metricdata.Metric) error {
+	e.sent.mux.Lock()
+	defer e.sent.mux.Unlock()
+
+	var lines []string
+	for _, m := range metrics {
+		for _, ts := range m.TimeSeries {
+			if len(ts.Points) == 0 {
+				continue
+			}
+			// the view data has only one point in each series
+			lines = append(lines, e.toLines(m.Descriptor, ts, ts.Points[len(ts.Points)-1])...)
+		}
+	}
+
+	var errs []error
+	for _, packet := range packLines(lines, e.maxPacketSize) {
+		if _, err := e.conn.Write(packet); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		log.Warnf("send %d packets to statsd failed, last error: %s", len(errs), errs[len(errs)-1])
+		return errs[len(errs)-1]
+	}
+	return nil
+}
+
+func (e *statsdExporter) toLines(desc metricdata.Descriptor, ts *metricdata.TimeSeries, p metricdata.Point) []string {
+	name, tags := e.nameAndTags(desc, ts.LabelValues, "")
+	key := desc.Name + labelValuesKey(ts.LabelValues)
+
+	switch v := p.Value.(type) {
+	case int64:
+		if desc.Type == metricdata.TypeCumulativeInt64 {
+			return []string{e.line(name, formatStatsd(e.delta(key, cumulativeValue{sum: float64(v)}).sum), "c", tags)}
+		}
+		return []string{e.line(name, strconv.FormatInt(v, 10), "g", tags)}
+	case float64:
+		if desc.Type == metricdata.TypeCumulativeFloat64 {
+			return []string{e.line(name, formatStatsd(e.delta(key, cumulativeValue{sum: v}).sum), "c", tags)}
+		}
+		return []string{e.line(name, formatStatsd(v), "g", tags)}
+	case *metricdata.Distribution:
+		buckets := make([]int64, len(v.Buckets))
+		for i, b := range v.Buckets {
+			buckets[i] = b.Count
+		}
+		d := e.delta(key, cumulativeValue{count: v.Count, sum: v.Sum, buckets: buckets})
+		if d.count <= 0 {
+			return nil
+		}
+		var bounds []float64
+		if v.BucketOptions != nil {
+			bounds = v.BucketOptions.Bounds
+		}
+		return e.distributionLines(name, tags, d, bounds)
+	case *metricdata.Summary:
+		// statsd can not restore the quantiles from the samples, so the min, max
+		// and quantiles of the window are sent as the gauges `name.p99`, with the
+		// increments of count and sum
+		d := e.delta(key, cumulativeValue{count: v.Count, sum: v.Sum})
+		lines := make([]string, 0, 2+len(v.Snapshot.Percentiles))
+		name, tags := e.nameAndTags(desc, ts.LabelValues, "count")
+		lines = append(lines, e.line(name, strconv.FormatInt(d.count, 10), "c", tags))
+		name, tags = e.nameAndTags(desc, ts.LabelValues, "sum")
+		lines = append(lines, e.line(name, formatStatsd(d.sum), "c", tags))
+		for _, p := range sortedPercentiles(v.Snapshot.Percentiles) {
+			name, tags = e.nameAndTags(desc, ts.LabelValues, percentileName(p))
+			lines = append(lines, e.line(name, formatStatsd(v.Snapshot.Percentiles[p]), "g", tags))
+		}
+		return lines
+	default:
+		return nil
+	}
+}
+
+// distributionLines sends the new samples of the distribution as timers, statsd
+// only receives the samples, so one sample per bucket is sent with the sample
+// rate of 1/count of the bucket, then statsd restores the count of each bucket.
+// The sample is the mean of the new samples if they are all in one bucket,
+// otherwise the middle of the bucket.
+func (e *statsdExporter) distributionLines(name, tags string, d cumulativeValue, bounds []float64) []string {
+	var lines []string
+	for i, count := range d.buckets {
+		if count <= 0 {
+			continue
+		}
+		value := d.sum / float64(d.count)
+		if count != d.count {
+			value = bucketValue(bounds, i)
+		}
+		lines = append(lines, e.line(name, formatStatsd(value), "ms|@"+strconv.FormatFloat(1/float64(count), 'g', -1, 64), tags))
+	}
+	return lines
+}
+
+// bucketValue returns the value representing the bucket `i` of `bounds`, the
+// first bucket is taken as starting from 0 for the positive bounds, and the
+// overflow bucket is represented by the last bound.
+func bucketValue(bounds []float64, i int) float64 {
+	switch {
+	case len(bounds) == 0:
+		return 0
+	case i == 0:
+		if bounds[0] > 0 {
+			return bounds[0] / 2
+		}
+		return bounds[0]
+	case i >= len(bounds):
+		return bounds[len(bounds)-1]
+	default:
+		return (bounds[i-1] + bounds[i]) / 2
+	}
+}
+
+// delta returns the increment of the cumulative series since the last report
+func (e *statsdExporter) delta(key string, v cumulativeValue) cumulativeValue {
+	last, ok := e.sent.last[key]
+	e.sent.last[key] = v
+	if !ok || v.count < last.count || v.sum < last.sum || len(v.buckets) != len(last.buckets) {
+		// the first report or the view is reset
+		return v
+	}
+	d := cumulativeValue{count: v.count - last.count, sum: v.sum - last.sum}
+	if len(v.buckets) > 0 {
+		d.buckets = make([]int64, len(v.buckets))
+		for i := range v.buckets {
+			d.buckets[i] = v.buckets[i] - last.buckets[i]
+		}
+	}
+	return d
+}
+
+// nameAndTags returns the statsd name `namespace.name.suffix` and the dogstatsd
+// tags, the tag values are appended to the name if dogstatsd is not enabled.
+func (e *statsdExporter) nameAndTags(desc metricdata.Descriptor, values []metricdata.LabelValue, suffix string) (string, string) {
+	names := []string{sanitizeStatsd(desc.Name)}
+	if suffix != "" {
+		names = append(names, suffix)
+	}
+	if e.namespace != "" {
+		names = append([]string{sanitizeStatsd(e.namespace)}, names...)
+	}
+
+	var tags []string
+	for i, lv := range values {
+		if !lv.Present || i >= len(desc.LabelKeys) {
+			continue
+		}
+		if e.dogStatsD {
+			tags = append(tags, sanitizeStatsd(desc.LabelKeys[i].Key)+":"+sanitizeStatsd(lv.Value))
+		} else {
+			names = append(names, sanitizeStatsd(lv.Value))
+		}
+	}
+	return strings.Join(names, "."), strings.Join(tags, ",")
+}
+
+func formatStatsd(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func (e *statsdExporter) line(name, value, typ, tags string) string {
+	l := name + ":" + value + "|" + typ
+	if tags != "" {
+		l += "|#" + tags
+	}
+	return l
+}
+
+// packLines joins the lines into packets not larger than `maxSize`, a line larger
+// than `maxSize` is sent in its own packet.
+func packLines(lines []string, maxSize int) [][]byte {
+	var packets [][]byte
+	var buf bytes.Buffer
+	for _, l := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(l) > maxSize {
+			packets = append(packets, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(l)
+	}
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
+
+func labelValuesKey(values []metricdata.LabelValue) string {
+	var b strings.Builder
+	for _, lv := range values {
+		b.WriteByte(0)
+		b.WriteString(lv.Value)
+	}
+	return b.String()
+}
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "#", "_", "\n", "_", " ", "_")
+
+func sanitizeStatsd(s string) string {
+	return statsdReplacer.Replace(s)
+}
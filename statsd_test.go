@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opencensus.io/metric/metricdata"
+)
+
+var testTime = time.Unix(1700000000, 0)
+
+func TestStatsdToLines(t *testing.T) {
+	keys := []metricdata.LabelKey{{Key: "miner"}}
+	values := []metricdata.LabelValue{metricdata.NewLabelValue("f01000")}
+	distribution := func(sum float64, counts ...int64) metricdata.Point {
+		d := &metricdata.Distribution{
+			Sum:           sum,
+			BucketOptions: &metricdata.BucketOptions{Bounds: []float64{10, 100}},
+		}
+		for _, c := range counts {
+			d.Count += c
+			d.Buckets = append(d.Buckets, metricdata.Bucket{Count: c})
+		}
+		return metricdata.NewDistributionPoint(testTime, d)
+	}
+
+	cases := []struct {
+		name      string
+		namespace string
+		dogStatsD bool
+		desc      metricdata.Descriptor
+		// points are reported in order, each one is expected to send its lines
+		points []metricdata.Point
+		want   [][]string
+	}{
+		{
+			name:   "gauge with tag values in the name",
+			desc:   metricdata.Descriptor{Name: "sector_count", Type: metricdata.TypeGaugeInt64, LabelKeys: keys},
+			points: []metricdata.Point{metricdata.NewInt64Point(testTime, 3)},
+			want:   [][]string{{"sector_count.f01000:3|g"}},
+		},
+		{
+			name:      "dogstatsd gauge with namespace",
+			namespace: "venus",
+			dogStatsD: true,
+			desc:      metricdata.Descriptor{Name: "balance", Type: metricdata.TypeGaugeFloat64, LabelKeys: keys},
+			points:    []metricdata.Point{metricdata.NewFloat64Point(testTime, 1.5)},
+			want:      [][]string{{"venus.balance:1.5|g|#miner:f01000"}},
+		},
+		{
+			name: "counter sends the increments",
+			desc: metricdata.Descriptor{Name: "requests_total", Type: metricdata.TypeCumulativeInt64, LabelKeys: keys},
+			points: []metricdata.Point{
+				metricdata.NewInt64Point(testTime, 5),
+				metricdata.NewInt64Point(testTime, 8),
+				// the view is reset
+				metricdata.NewInt64Point(testTime, 2),
+			},
+			want: [][]string{
+				{"requests_total.f01000:5|c"},
+				{"requests_total.f01000:3|c"},
+				{"requests_total.f01000:2|c"},
+			},
+		},
+		{
+			name: "distribution sends one sample per bucket",
+			desc: metricdata.Descriptor{Name: "latency", Type: metricdata.TypeCumulativeDistribution},
+			points: []metricdata.Point{
+				// all the samples are in one bucket, so the mean is exact
+				distribution(8, 2, 0, 0),
+				distribution(8+110+300, 2, 2, 1),
+				// nothing new
+				distribution(8+110+300, 2, 2, 1),
+			},
+			want: [][]string{
+				{"latency:4|ms|@0.5"},
+				{"latency:55|ms|@0.5", "latency:100|ms|@1"},
+				nil,
+			},
+		},
+		{
+			name: "summary sends the quantiles as gauges",
+			desc: metricdata.Descriptor{Name: "latency", Type: metricdata.TypeSummary},
+			points: []metricdata.Point{
+				metricdata.NewSummaryPoint(testTime, &metricdata.Summary{
+					Count:    3,
+					Sum:      6,
+					Snapshot: metricdata.Snapshot{Percentiles: map[float64]float64{0: 1, 50: 2, 100: 3}},
+				}),
+			},
+			want: [][]string{{"latency.count:3|c", "latency.sum:6|c", "latency.min:1|g", "latency.p50:2|g", "latency.max:3|g"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := &statsdExporter{
+				namespace: c.namespace,
+				dogStatsD: c.dogStatsD,
+				sent:      newCumulativeValues(),
+			}
+			for i, p := range c.points {
+				lvs := values
+				if len(c.desc.LabelKeys) == 0 {
+					lvs = nil
+				}
+				got := e.toLines(c.desc, &metricdata.TimeSeries{LabelValues: lvs}, p)
+				if !reflect.DeepEqual(got, c.want[i]) {
+					t.Errorf("report %d: expect %q, got %q", i, c.want[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestPackLines(t *testing.T) {
+	cases := []struct {
+		name    string
+		lines   []string
+		maxSize int
+		want    []string
+	}{
+		{
+			name:    "no lines",
+			maxSize: 10,
+		},
+		{
+			name:    "fit in one packet",
+			lines:   []string{"a:1|c", "b:2|g"},
+			maxSize: 11,
+			want:    []string{"a:1|c\nb:2|g"},
+		},
+		{
+			name:    "split when the newline does not fit",
+			lines:   []string{"a:1|c", "b:2|g"},
+			maxSize: 10,
+			want:    []string{"a:1|c", "b:2|g"},
+		},
+		{
+			name:    "oversized line in its own packet",
+			lines:   []string{"a:1|c", "long_name:100|g", "b:2|g"},
+			maxSize: 8,
+			want:    []string{"a:1|c", "long_name:100|g", "b:2|g"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got []string
+			for _, p := range packLines(c.lines, c.maxSize) {
+				got = append(got, string(p))
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("expect %q, got %q", c.want, got)
+			}
+		})
+	}
+}
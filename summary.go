@@ -0,0 +1,369 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+	"go.opencensus.io/tag"
+)
+
+var (
+	// DefaultQuantiles are the quantiles reported by NewInt64WithSummarizer
+	DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+	// DefaultSummaryMaxAge is the sliding window of NewInt64WithSummarizer
+	DefaultSummaryMaxAge = 10 * time.Minute
+)
+
+const (
+	// summaryAgeBuckets is the number of buckets the window is split into, the
+	// oldest bucket is dropped when the window slides.
+	summaryAgeBuckets = 5
+	// summaryBucketSamples caps the samples kept in each bucket, the samples
+	// beyond it are reservoir sampled, so the quantiles of a busy series are
+	// estimated while count, sum, min and max stay exact.
+	summaryBucketSamples = 1024
+)
+
+// summarizer reports the cumulative count and sum, and the min, max and
+// quantiles over a sliding window of the values of each tag set.
+type summarizer struct {
+	name      string
+	desc      string
+	unit      string
+	keys      []tag.Key
+	quantiles []float64
+	maxAge    time.Duration
+
+	mux    sync.Mutex
+	series map[string]*summarySeries
+}
+
+type summarySeries struct {
+	labelValues []metricdata.LabelValue
+	start       time.Time
+	count       int64
+	sum         float64
+
+	// buckets is a ring, the one at head receives the new values until
+	// headExpires
+	buckets     []summaryBucket
+	head        int
+	headExpires time.Time
+}
+
+type summaryBucket struct {
+	samples []float64
+	count   int64
+	sum     float64
+	min     float64
+	max     float64
+}
+
+func newSummarizer(name, desc, unit string, quantiles []float64, maxAge time.Duration, keys []tag.Key) (*summarizer, error) {
+	for _, q := range quantiles {
+		if q <= 0 || q >= 1 {
+			return nil, fmt.Errorf("quantile must be in (0, 1), got %v", q)
+		}
+	}
+	if maxAge <= 0 {
+		return nil, fmt.Errorf("max age must be positive, got %s", maxAge)
+	}
+
+	s := &summarizer{
+		name:      name,
+		desc:      desc,
+		unit:      unit,
+		keys:      keys,
+		quantiles: append([]float64(nil), quantiles...),
+		maxAge:    maxAge,
+		series:    make(map[string]*summarySeries),
+	}
+	sort.Float64s(s.quantiles)
+	if err := summaries.add(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// observe adds `v` to the series of the tags in `ctx`
+func (s *summarizer) observe(ctx context.Context, v float64) {
+	m := tag.FromContext(ctx)
+	values := make([]metricdata.LabelValue, len(s.keys))
+	for i, k := range s.keys {
+		if m != nil {
+			if value, ok := m.Value(k); ok {
+				values[i] = metricdata.NewLabelValue(value)
+			}
+		}
+	}
+
+	now := time.Now()
+	key := labelValuesKey(values)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	series, ok := s.series[key]
+	if !ok {
+		series = &summarySeries{
+			labelValues: values,
+			start:       now,
+			buckets:     make([]summaryBucket, summaryAgeBuckets),
+			headExpires: now.Add(s.bucketAge()),
+		}
+		s.series[key] = series
+	}
+	series.rotate(now, s.bucketAge())
+
+	series.count++
+	series.sum += v
+	b := &series.buckets[series.head]
+	if b.count == 0 || v < b.min {
+		b.min = v
+	}
+	if b.count == 0 || v > b.max {
+		b.max = v
+	}
+	b.count++
+	b.sum += v
+	if len(b.samples) < summaryBucketSamples {
+		b.samples = append(b.samples, v)
+	} else if j := rand.Int63n(b.count); j < summaryBucketSamples {
+		b.samples[j] = v
+	}
+}
+
+func (s *summarizer) bucketAge() time.Duration {
+	return s.maxAge / summaryAgeBuckets
+}
+
+// rotate drops the buckets older than the window
+func (ss *summarySeries) rotate(now time.Time, bucketAge time.Duration) {
+	for i := 0; !now.Before(ss.headExpires); i++ {
+		if i >= len(ss.buckets) {
+			// all the buckets are expired
+			ss.headExpires = now.Add(bucketAge)
+			return
+		}
+		ss.head = (ss.head + 1) % len(ss.buckets)
+		ss.buckets[ss.head] = summaryBucket{samples: ss.buckets[ss.head].samples[:0]}
+		ss.headExpires = ss.headExpires.Add(bucketAge)
+	}
+}
+
+// snapshot returns the summary of the series, the percentiles of the window
+// are keyed by 0 for min, 100 for max and the quantiles times 100.
+func (ss *summarySeries) snapshot(quantiles []float64) *metricdata.Summary {
+	summary := &metricdata.Summary{
+		Count:          ss.count,
+		Sum:            ss.sum,
+		HasCountAndSum: true,
+	}
+
+	var samples []float64
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, b := range ss.buckets {
+		if b.count == 0 {
+			continue
+		}
+		summary.Snapshot.Count += b.count
+		summary.Snapshot.Sum += b.sum
+		min = math.Min(min, b.min)
+		max = math.Max(max, b.max)
+		samples = append(samples, b.samples...)
+	}
+	if summary.Snapshot.Count == 0 {
+		return summary
+	}
+
+	sort.Float64s(samples)
+	summary.Snapshot.Percentiles = map[float64]float64{0: min, 100: max}
+	for _, q := range quantiles {
+		idx := int(math.Ceil(q*float64(len(samples)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		summary.Snapshot.Percentiles[q*100] = samples[idx]
+	}
+	return summary
+}
+
+func (s *summarizer) metric(now time.Time) *metricdata.Metric {
+	labelKeys := make([]metricdata.LabelKey, len(s.keys))
+	for i, k := range s.keys {
+		labelKeys[i] = metricdata.LabelKey{Key: k.Name()}
+	}
+	m := &metricdata.Metric{
+		Descriptor: metricdata.Descriptor{
+			Name:        s.name,
+			Description: s.desc,
+			Unit:        metricdata.Unit(s.unit),
+			Type:        metricdata.TypeSummary,
+			LabelKeys:   labelKeys,
+		},
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, series := range s.series {
+		series.rotate(now, s.bucketAge())
+		m.TimeSeries = append(m.TimeSeries, &metricdata.TimeSeries{
+			LabelValues: series.labelValues,
+			Points:      []metricdata.Point{metricdata.NewSummaryPoint(now, series.snapshot(s.quantiles))},
+			StartTime:   series.start,
+		})
+	}
+	return m
+}
+
+// summaryProducer produces the metrics of all the summarizers, it is added to
+// the global producer manager, so the summaries are read by the exporters along
+// with the views.
+type summaryProducer struct {
+	mux         sync.Mutex
+	summarizers map[string]*summarizer
+	once        sync.Once
+}
+
+var summaries = &summaryProducer{summarizers: make(map[string]*summarizer)}
+
+func (p *summaryProducer) add(s *summarizer) error {
+	p.once.Do(func() {
+		metricproducer.GlobalManager().AddProducer(p)
+	})
+
+	if err := checkViewUnregistered(s.name); err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.summarizers[s.name] = s
+	return nil
+}
+
+// Read implements metricproducer.Producer
+func (p *summaryProducer) Read() []*metricdata.Metric {
+	p.mux.Lock()
+	list := make([]*summarizer, 0, len(p.summarizers))
+	for _, s := range p.summarizers {
+		list = append(list, s)
+	}
+	p.mux.Unlock()
+
+	now := time.Now()
+	metrics := make([]*metricdata.Metric, 0, len(list))
+	for _, s := range list {
+		metrics = append(metrics, s.metric(now))
+	}
+	return metrics
+}
+
+// summaryCollector exports the summaries as prometheus summaries, which the
+// opencensus prometheus exporter does not support. It is an unchecked collector,
+// since the summaries can be added after it is registered.
+type summaryCollector struct {
+	namespace string
+}
+
+func (c *summaryCollector) Describe(chan<- *promclient.Desc) {}
+
+func (c *summaryCollector) Collect(ch chan<- promclient.Metric) {
+	for _, m := range summaries.Read() {
+		labels := make([]string, len(m.Descriptor.LabelKeys))
+		for i, k := range m.Descriptor.LabelKeys {
+			labels[i] = sanitizePrometheusLabel(k.Key)
+		}
+		name := sanitizePrometheusName(m.Descriptor.Name)
+		if c.namespace != "" {
+			name = c.namespace + "_" + name
+		}
+		desc := promclient.NewDesc(name, m.Descriptor.Description, labels, nil)
+
+		for _, ts := range m.TimeSeries {
+			values := make([]string, len(ts.LabelValues))
+			for i, lv := range ts.LabelValues {
+				values[i] = lv.Value
+			}
+			for _, p := range ts.Points {
+				summary := p.Value.(*metricdata.Summary)
+				quantiles := make(map[float64]float64, len(summary.Snapshot.Percentiles))
+				for p, v := range summary.Snapshot.Percentiles {
+					quantiles[p/100] = v
+				}
+				ch <- promclient.MustNewConstSummary(desc, uint64(summary.Count), summary.Sum, quantiles, values...)
+			}
+		}
+	}
+}
+
+// sanitizePrometheusName replaces the characters not allowed in prometheus
+// metric names with underscores, a name starting with a digit is prefixed with
+// an underscore.
+func sanitizePrometheusName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, s)
+	if s != "" && s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	return s
+}
+
+// sanitizePrometheusLabel replaces the characters not allowed in prometheus
+// label names with underscores, like the opencensus prometheus exporter does,
+// the labels starting with an underscore are reserved, so they are prefixed
+// with `key`.
+func sanitizePrometheusLabel(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+	if s != "" && s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	if s != "" && s[0] == '_' {
+		s = "key" + s
+	}
+	return s
+}
+
+// percentileName names the percentile of the summary snapshot for the exporters
+// without summary support: `min`, `max` or `p50`, `p99_9`.
+func percentileName(p float64) string {
+	switch p {
+	case 0:
+		return "min"
+	case 100:
+		return "max"
+	default:
+		return "p" + strings.ReplaceAll(strconv.FormatFloat(p, 'f', -1, 64), ".", "_")
+	}
+}
+
+// sortedPercentiles returns the percentiles of the snapshot in order
+func sortedPercentiles(percentiles map[float64]float64) []float64 {
+	ps := make([]float64, 0, len(percentiles))
+	for p := range percentiles {
+		ps = append(ps, p)
+	}
+	sort.Float64s(ps)
+	return ps
+}
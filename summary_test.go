@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/tag"
+)
+
+// newTestSummarizer creates a summarizer which is not added to the producer
+func newTestSummarizer(maxAge time.Duration, keys ...tag.Key) *summarizer {
+	return &summarizer{
+		name:      "summary_test",
+		keys:      keys,
+		quantiles: DefaultQuantiles,
+		maxAge:    maxAge,
+		series:    make(map[string]*summarySeries),
+	}
+}
+
+// onlySeries returns the only series of `s`
+func onlySeries(t *testing.T, s *summarizer) *summarySeries {
+	t.Helper()
+	if len(s.series) != 1 {
+		t.Fatalf("expect 1 series, got %d", len(s.series))
+	}
+	for _, ss := range s.series {
+		return ss
+	}
+	return nil
+}
+
+func TestSummarizerQuantiles(t *testing.T) {
+	key := tag.MustNewKey("stage")
+	s := newTestSummarizer(time.Hour, key)
+	ctx, err := tag.New(context.Background(), tag.Insert(key, "commit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// in reverse order, the samples are sorted by the snapshot
+	for v := 100; v > 0; v-- {
+		s.observe(ctx, float64(v))
+	}
+
+	ss := onlySeries(t, s)
+	if want := []metricdata.LabelValue{metricdata.NewLabelValue("commit")}; !reflect.DeepEqual(ss.labelValues, want) {
+		t.Errorf("expect label values %v, got %v", want, ss.labelValues)
+	}
+	summary := ss.snapshot(s.quantiles)
+	if summary.Count != 100 || summary.Sum != 5050 {
+		t.Errorf("expect count 100 and sum 5050, got %d and %v", summary.Count, summary.Sum)
+	}
+	if summary.Snapshot.Count != 100 || summary.Snapshot.Sum != 5050 {
+		t.Errorf("expect window count 100 and sum 5050, got %d and %v", summary.Snapshot.Count, summary.Snapshot.Sum)
+	}
+	want := map[float64]float64{0: 1, 50: 50, 90: 90, 99: 99, 100: 100}
+	if !reflect.DeepEqual(summary.Snapshot.Percentiles, want) {
+		t.Errorf("expect percentiles %v, got %v", want, summary.Snapshot.Percentiles)
+	}
+}
+
+func TestSummarizerWindow(t *testing.T) {
+	s := newTestSummarizer(time.Hour)
+	ctx := context.Background()
+	s.observe(ctx, 1)
+	ss := onlySeries(t, s)
+
+	// the value is kept until its bucket is dropped
+	expires := ss.headExpires
+	ss.rotate(expires, s.bucketAge())
+	s.observe(ctx, 100)
+	if got := ss.snapshot(s.quantiles).Snapshot; got.Count != 2 || got.Percentiles[0] != 1 {
+		t.Errorf("expect both values in the window, got %+v", got)
+	}
+
+	ss.rotate(expires.Add((summaryAgeBuckets-1)*s.bucketAge()), s.bucketAge())
+	summary := ss.snapshot(s.quantiles)
+	if got := summary.Snapshot; got.Count != 1 || got.Percentiles[0] != 100 || got.Percentiles[100] != 100 {
+		t.Errorf("expect only the newer value in the window, got %+v", got)
+	}
+
+	ss.rotate(expires.Add(10*s.maxAge), s.bucketAge())
+	summary = ss.snapshot(s.quantiles)
+	if summary.Snapshot.Count != 0 || summary.Snapshot.Percentiles != nil {
+		t.Errorf("expect the empty window, got %+v", summary.Snapshot)
+	}
+	// count and sum are cumulative
+	if summary.Count != 2 || summary.Sum != 101 {
+		t.Errorf("expect count 2 and sum 101, got %d and %v", summary.Count, summary.Sum)
+	}
+}
+
+func TestSummarizerReservoir(t *testing.T) {
+	s := newTestSummarizer(time.Hour)
+	ctx := context.Background()
+	n := 10 * summaryBucketSamples
+	for v := 1; v <= n; v++ {
+		s.observe(ctx, float64(v))
+	}
+
+	ss := onlySeries(t, s)
+	if got := len(ss.buckets[ss.head].samples); got != summaryBucketSamples {
+		t.Errorf("expect %d samples kept, got %d", summaryBucketSamples, got)
+	}
+	summary := ss.snapshot(s.quantiles)
+	// count, sum, min and max are exact
+	if summary.Snapshot.Count != int64(n) || summary.Snapshot.Sum != float64(n*(n+1)/2) {
+		t.Errorf("expect window count %d, got %d and sum %v", n, summary.Snapshot.Count, summary.Snapshot.Sum)
+	}
+	if summary.Snapshot.Percentiles[0] != 1 || summary.Snapshot.Percentiles[100] != float64(n) {
+		t.Errorf("expect min 1 and max %d, got %v", n, summary.Snapshot.Percentiles)
+	}
+	// the quantiles are estimated from the samples
+	for _, q := range s.quantiles {
+		want, got := q*float64(n), summary.Snapshot.Percentiles[q*100]
+		if math.Abs(got-want) > 0.1*float64(n) {
+			t.Errorf("expect quantile %v near %v, got %v", q, want, got)
+		}
+	}
+}
+
+func TestSummaryCollector(t *testing.T) {
+	key := tag.MustNewKey("sector-stage")
+	summary, err := TryNewInt64WithQuantiles("summary_collector/latency", "latency of the stages", "ms", DefaultQuantiles, time.Hour, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the summary is registered once, so each run of the test observes the
+	// values of its own series
+	stage := "commit-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	ctx, err := tag.New(context.Background(), tag.Insert(key, stage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := int64(1); v <= 10; v++ {
+		summary.Set(ctx, v)
+	}
+
+	reg := promclient.NewRegistry()
+	reg.MustRegister(&summaryCollector{namespace: "venus"})
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var family *dto.MetricFamily
+	for _, f := range families {
+		if f.GetName() == "venus_summary_collector_latency" {
+			family = f
+		}
+	}
+	if family == nil {
+		t.Fatal("summary venus_summary_collector_latency is not collected")
+	}
+	if family.GetType() != dto.MetricType_SUMMARY || family.GetHelp() != "latency of the stages" {
+		t.Errorf("expect the summary with help, got %s %q", family.GetType(), family.GetHelp())
+	}
+	var m *dto.Metric
+	for _, series := range family.Metric {
+		if len(series.Label) == 1 && series.Label[0].GetName() == "sector_stage" && series.Label[0].GetValue() == stage {
+			m = series
+		}
+	}
+	if m == nil {
+		t.Fatalf("series of label sector_stage=%s is not collected: %v", stage, family.Metric)
+	}
+	if m.Summary.GetSampleCount() != 10 || m.Summary.GetSampleSum() != 55 {
+		t.Errorf("expect count 10 and sum 55, got %d and %v", m.Summary.GetSampleCount(), m.Summary.GetSampleSum())
+	}
+	quantiles := make(map[float64]float64)
+	for _, q := range m.Summary.Quantile {
+		quantiles[q.GetQuantile()] = q.GetValue()
+	}
+	want := map[float64]float64{0: 1, 0.5: 5, 0.9: 9, 0.99: 10, 1: 10}
+	if !reflect.DeepEqual(quantiles, want) {
+		t.Errorf("expect quantiles %v, got %v", want, quantiles)
+	}
+}
@@ -17,27 +17,37 @@ func NewTimerMs(name, desc string, tagKeys ...tag.Key) *Float64Timer {
 	return NewTimerWithBuckets(name, desc, stats.UnitMilliseconds, defaultBounds, tagKeys...)
 }
 
+// TryNewTimerMs is NewTimerMs returning the error instead of panic
+func TryNewTimerMs(name, desc string, tagKeys ...tag.Key) (*Float64Timer, error) {
+	defaultBounds := []float64{25, 50, 75, 100, 200, 400, 600, 800, 1000, 2000, 4000, 8000}
+	return TryNewTimerWithBuckets(name, desc, stats.UnitMilliseconds, defaultBounds, tagKeys...)
+}
+
 // NewTimerWithBuckets creates a Float64Timer wrapping an opencensus float64 measurement.
 func NewTimerWithBuckets(name, desc, unit string, bounds []float64, tagKeys ...tag.Key) *Float64Timer {
-	fMeasure := stats.Float64(name, desc, unit)
-	fView := &view.View{
-		Name:        name,
-		Measure:     fMeasure,
-		Description: desc,
-		TagKeys:     tagKeys,
-		Aggregation: view.Distribution(bounds...),
-	}
-	if err := view.Register(fView); err != nil {
+	t, err := TryNewTimerWithBuckets(name, desc, unit, bounds, tagKeys...)
+	if err != nil {
 		// a panic here indicates a developer error when creating a view.
 		// Since this method is called in init() methods, this panic when hit
 		// will cause running the program to fail immediately.
 		panic(err)
 	}
+	return t
+}
 
-	return &Float64Timer{
-		measureMs: fMeasure,
-		view:      fView,
+// TryNewTimerWithBuckets is NewTimerWithBuckets returning the error instead of
+// panic, the timer declared again with the same definition is the registered one.
+func TryNewTimerWithBuckets(name, desc, unit string, bounds []float64, tagKeys ...tag.Key) (*Float64Timer, error) {
+	m, err := newFloat64View("Float64Timer", name, name, desc, unit, view.Distribution(bounds...), tagKeys, func(fMeasure *stats.Float64Measure, fView *view.View) interface{} {
+		return &Float64Timer{
+			measureMs: fMeasure,
+			view:      fView,
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
+	return m.(*Float64Timer), nil
 }
 
 // Float64Timer contains a opencensus measurement and view
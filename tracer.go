@@ -0,0 +1,310 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ipfs-force-community/metrics/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/bridge/opencensus"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+type TraceExporterType string
+
+const (
+	TETJaeger TraceExporterType = "jaeger"
+	TETOTLP   TraceExporterType = "otlp"
+	TETZipkin TraceExporterType = "zipkin"
+)
+
+type JaegerMode string
+
+const (
+	// JMAgent sends spans to the jaeger agent over udp
+	JMAgent JaegerMode = "agent"
+	// JMCollector sends spans to the jaeger collector over http
+	JMCollector JaegerMode = "collector"
+)
+
+// SetupTracing setups the trace exporter chosen by `cfg.Exporter` and names the
+// tracer. The opencensus bridge is installed, so spans started by `trace.StartSpan`
+// are exported too. It returns nil if tracing is not enabled.
+func SetupTracing(serviceName string, cfg *TraceConfig) (*tracesdk.TracerProvider, error) {
+	if !cfg.TracingEnabled && !cfg.JaegerTracingEnabled {
+		return nil, nil
+	}
+
+	return setupTracing(serviceName, cfg)
+}
+
+// SetupJaegerTracing setups the jaeger endpoint and names the
+// tracer.
+//
+// Deprecated: the jaeger exporter is deprecated upstream, use SetupTracing instead.
+func SetupJaegerTracing(serviceName string, cfg *TraceConfig) (*tracesdk.TracerProvider, error) {
+	if !cfg.JaegerTracingEnabled {
+		return nil, nil
+	}
+
+	jaegerCfg := *cfg
+	jaegerCfg.Exporter = TETJaeger
+	return setupTracing(serviceName, &jaegerCfg)
+}
+
+// tracingState is the reloadable part of a tracer provider set up by setupTracing
+type tracingState struct {
+	mux       sync.Mutex
+	sampler   *reloadableSampler
+	processor tracesdk.SpanProcessor
+}
+
+// tracingStates maps the tracer providers set up by setupTracing to their state
+var tracingStates sync.Map
+
+func setupTracing(serviceName string, cfg *TraceConfig) (*tracesdk.TracerProvider, error) {
+	tp, err := newTracerProvider(serviceName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := startTracing(context.Background(), tp, cfg); err != nil {
+		tracingStates.Delete(tp)
+		return nil, err
+	}
+	return tp, nil
+}
+
+// newTracerProvider creates the tracer provider without exporter, nothing is
+// sampled or exported until it is started by startTracing.
+func newTracerProvider(serviceName string, cfg *TraceConfig) (*tracesdk.TracerProvider, error) {
+	if len(cfg.ServerName) != 0 {
+		serviceName = cfg.ServerName
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid trace config: %w", err)
+	}
+
+	state := &tracingState{
+		sampler: newReloadableSampler(tracesdk.NeverSample()),
+	}
+	tp := tracesdk.NewTracerProvider(
+		// Record information about this application in an Resource.
+		tracesdk.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+		tracesdk.WithSampler(state.sampler),
+	)
+	tracingStates.Store(tp, state)
+	return tp, nil
+}
+
+// startTracing applies the exporter, the sampler and the propagators of `cfg` to
+// `tp`, then installs it as the global tracer provider and the opencensus bridge.
+func startTracing(ctx context.Context, tp *tracesdk.TracerProvider, cfg *TraceConfig) error {
+	if err := reloadTracing(ctx, tp, cfg); err != nil {
+		return err
+	}
+	otel.SetTracerProvider(tp)
+	opencensus.InstallTraceBridge(opencensus.WithTracerProvider(tp))
+	return nil
+}
+
+// ReloadTracing applies `cfg` to the tracer provider returned by SetupTracing.
+// The sampler, the propagators and the exporter are swapped in place, the spans
+// started before are exported by the new exporter when they end, and the spans
+// queued for the old exporter are flushed before it is shut down. If tracing is
+// disabled by `cfg`, no span is sampled until it is enabled again. The service
+// name can not be changed.
+func ReloadTracing(ctx context.Context, tp *tracesdk.TracerProvider, cfg *TraceConfig) error {
+	if err := reloadTracing(ctx, tp, cfg); err != nil {
+		return err
+	}
+	log.Infof("trace config reloaded, enabled: %t, exporter: %s", cfg.TracingEnabled || cfg.JaegerTracingEnabled, cfg.Exporter)
+	return nil
+}
+
+func reloadTracing(ctx context.Context, tp *tracesdk.TracerProvider, cfg *TraceConfig) error {
+	v, ok := tracingStates.Load(tp)
+	if !ok {
+		return fmt.Errorf("tracer provider is not set up by SetupTracing")
+	}
+	state := v.(*tracingState)
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid trace config: %w", err)
+	}
+	propagator, err := tracing.NewPropagator(cfg.Propagators...)
+	if err != nil {
+		return err
+	}
+
+	enabled := cfg.TracingEnabled || cfg.JaegerTracingEnabled
+	sampler := tracesdk.NeverSample()
+	var processor tracesdk.SpanProcessor
+	if enabled {
+		if sampler, err = newSampler(cfg); err != nil {
+			return err
+		}
+		exporter, err := newSpanExporter(cfg)
+		if err != nil {
+			return err
+		}
+		processor = tracesdk.NewBatchSpanProcessor(exporter)
+	}
+
+	state.mux.Lock()
+	defer state.mux.Unlock()
+
+	// register the new processor first, so the spans ending in between are not lost
+	if processor != nil {
+		tp.RegisterSpanProcessor(processor)
+	}
+	if state.processor != nil {
+		if err := state.processor.ForceFlush(ctx); err != nil {
+			log.Warnf("failed to flush the previous span exporter: %s", err)
+		}
+		// the processor is shut down once it is unregistered
+		tp.UnregisterSpanProcessor(state.processor)
+	}
+	state.processor = processor
+	state.sampler.set(sampler)
+	otel.SetTextMapPropagator(propagator)
+	return nil
+}
+
+func newSpanExporter(cfg *TraceConfig) (tracesdk.SpanExporter, error) {
+	switch cfg.Exporter {
+	case TETJaeger, "":
+		return newJaegerExporter(cfg)
+	case TETOTLP:
+		return newOTLPSpanExporter(cfg.OTLP)
+	case TETZipkin:
+		return zipkin.New(cfg.ZipkinEndpoint)
+	default:
+		return nil, fmt.Errorf("wrong trace exporter type: %s", cfg.Exporter)
+	}
+}
+
+// jaegerMode returns the configured jaeger mode, if it is empty the mode is inferred
+// from the endpoint, `http://` and `https://` are collector endpoints, so are the
+// endpoints without scheme but with a path like `host:14268/api/traces`, which is
+// how the collector used to be configured. `udp://` and `host:port` are agent
+// endpoints.
+func jaegerMode(cfg *TraceConfig) JaegerMode {
+	if cfg.JaegerMode != "" {
+		return cfg.JaegerMode
+	}
+	endpoint := cfg.JaegerEndpoint
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return JMCollector
+	}
+	if !strings.Contains(endpoint, "://") && strings.Contains(endpoint, "/") {
+		return JMCollector
+	}
+	return JMAgent
+}
+
+// jaegerCollectorEndpoint adds the `http://` scheme to the collector endpoint
+// without scheme
+func jaegerCollectorEndpoint(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	return "http://" + endpoint
+}
+
+func newJaegerExporter(cfg *TraceConfig) (tracesdk.SpanExporter, error) {
+	switch mode := jaegerMode(cfg); mode {
+	case JMAgent:
+		host, port, err := net.SplitHostPort(strings.TrimPrefix(cfg.JaegerEndpoint, "udp://"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid jaeger agent endpoint %s: %w", cfg.JaegerEndpoint, err)
+		}
+		opts := []jaeger.AgentEndpointOption{
+			jaeger.WithAgentHost(host),
+			jaeger.WithAgentPort(port),
+		}
+		if cfg.JaegerMaxPacketSize > 0 {
+			opts = append(opts, jaeger.WithMaxPacketSize(cfg.JaegerMaxPacketSize))
+		}
+		return jaeger.New(jaeger.WithAgentEndpoint(opts...))
+	case JMCollector:
+		opts := []jaeger.CollectorEndpointOption{
+			jaeger.WithEndpoint(jaegerCollectorEndpoint(cfg.JaegerEndpoint)),
+		}
+		if cfg.JaegerUsername != "" {
+			opts = append(opts, jaeger.WithUsername(cfg.JaegerUsername), jaeger.WithPassword(cfg.JaegerPassword))
+		}
+		return jaeger.New(jaeger.WithCollectorEndpoint(opts...))
+	default:
+		return nil, fmt.Errorf("wrong jaeger mode: %s", mode)
+	}
+}
+
+func newOTLPSpanExporter(cfg *TraceOTLPExporterConfig) (tracesdk.SpanExporter, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("otlp trace exporter is not configured")
+	}
+
+	switch cfg.Protocol {
+	case OTLPGRPC:
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(cfg.Endpoint),
+			otlptracegrpc.WithHeaders(cfg.Headers),
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		switch cfg.Compression {
+		case "", "none":
+		case "gzip":
+			opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+		default:
+			return nil, fmt.Errorf("unsupported compression: %s", cfg.Compression)
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+	case OTLPHTTP:
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(cfg.Endpoint),
+			otlptracehttp.WithHeaders(cfg.Headers),
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		switch cfg.Compression {
+		case "", "none":
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.NoCompression))
+		case "gzip":
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		default:
+			return nil, fmt.Errorf("unsupported compression: %s", cfg.Compression)
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("wrong otlp protocol: %s", cfg.Protocol)
+	}
+}
+
+// ShutdownTracing flushes the pending spans and shuts down the tracer provider.
+func ShutdownTracing(ctx context.Context, tp *tracesdk.TracerProvider) error {
+	tracingStates.Delete(tp)
+	if err := tp.ForceFlush(ctx); err != nil {
+		log.Warnf("failed to flush tracer provider: %s", err)
+	}
+	return tp.Shutdown(ctx)
+}
+
+// ShutdownJaeger is the alias of ShutdownTracing
+func ShutdownJaeger(ctx context.Context, je *tracesdk.TracerProvider) error {
+	return ShutdownTracing(ctx, je)
+}
@@ -0,0 +1,198 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	octrace "go.opencensus.io/trace"
+	"go.opentelemetry.io/otel"
+)
+
+func TestNewSpanExporter(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(cfg *TraceConfig)
+		// want is the type of the exporter, or the error
+		want string
+		err  string
+	}{
+		{
+			name: "default is jaeger",
+			modify: func(cfg *TraceConfig) {
+				cfg.Exporter = ""
+			},
+			want: "*jaeger.Exporter",
+		},
+		{
+			name: "otlp grpc",
+			modify: func(cfg *TraceConfig) {
+				cfg.Exporter = TETOTLP
+				cfg.OTLP.Protocol = OTLPGRPC
+			},
+			want: "*otlptrace.Exporter",
+		},
+		{
+			name: "otlp http",
+			modify: func(cfg *TraceConfig) {
+				cfg.Exporter = TETOTLP
+				cfg.OTLP.Protocol = OTLPHTTP
+				cfg.OTLP.Compression = "gzip"
+			},
+			want: "*otlptrace.Exporter",
+		},
+		{
+			name: "otlp without config",
+			modify: func(cfg *TraceConfig) {
+				cfg.Exporter = TETOTLP
+				cfg.OTLP = nil
+			},
+			err: "otlp trace exporter is not configured",
+		},
+		{
+			name: "zipkin",
+			modify: func(cfg *TraceConfig) {
+				cfg.Exporter = TETZipkin
+				cfg.ZipkinEndpoint = "http://localhost:9411/api/v2/spans"
+			},
+			want: "*zipkin.Exporter",
+		},
+		{
+			name: "unknown",
+			modify: func(cfg *TraceConfig) {
+				cfg.Exporter = "datadog"
+			},
+			err: "wrong trace exporter type: datadog",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultTraceConfig()
+			c.modify(cfg)
+			e, err := newSpanExporter(cfg)
+			if c.err != "" {
+				if err == nil || err.Error() != c.err {
+					t.Errorf("expect error %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Shutdown(context.Background()) //nolint:errcheck
+			if got := fmt.Sprintf("%T", e); got != c.want {
+				t.Errorf("expect %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+// the spans started by otel and opencensus are both exported by SetupTracing
+func TestSetupTracingZipkin(t *testing.T) {
+	var (
+		mux  sync.Mutex
+		body strings.Builder
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mux.Lock()
+		body.Write(b)
+		mux.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultTraceConfig()
+	cfg.TracingEnabled = true
+	cfg.Exporter = TETZipkin
+	cfg.ZipkinEndpoint = srv.URL + "/api/v2/spans"
+	cfg.ProbabilitySampler = 1
+	tp, err := SetupTracing("zipkin-test", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "otel-span")
+	_, ocSpan := octrace.StartSpan(ctx, "opencensus-span")
+	ocSpan.End()
+	span.End()
+
+	if err := ShutdownTracing(context.Background(), tp); err != nil {
+		t.Fatal(err)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	for _, want := range []string{"otel-span", "opencensus-span", "zipkin-test"} {
+		if !strings.Contains(body.String(), want) {
+			t.Errorf("expect %s in the exported spans: %s", want, body.String())
+		}
+	}
+}
+
+func TestJaegerMode(t *testing.T) {
+	cases := []struct {
+		endpoint string
+		mode     JaegerMode
+		want     JaegerMode
+	}{
+		{endpoint: "localhost:6831", want: JMAgent},
+		{endpoint: "udp://localhost:6831", want: JMAgent},
+		{endpoint: "http://localhost:14268/api/traces", want: JMCollector},
+		{endpoint: "https://jaeger.example.com/api/traces", want: JMCollector},
+		// the collector endpoint of the old configs
+		{endpoint: "localhost:14268/api/traces", want: JMCollector},
+		{endpoint: "localhost:14268/api/traces", mode: JMAgent, want: JMAgent},
+		{endpoint: "localhost:6831", mode: JMCollector, want: JMCollector},
+	}
+
+	for _, c := range cases {
+		t.Run(c.endpoint+"/"+string(c.mode), func(t *testing.T) {
+			cfg := DefaultTraceConfig()
+			cfg.JaegerEndpoint = c.endpoint
+			cfg.JaegerMode = c.mode
+			if got := jaegerMode(cfg); got != c.want {
+				t.Errorf("expect %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestNewJaegerExporter(t *testing.T) {
+	cases := []struct {
+		name     string
+		endpoint string
+		mode     JaegerMode
+		err      bool
+	}{
+		{name: "agent", endpoint: "udp://127.0.0.1:6831"},
+		{name: "collector without scheme", endpoint: "127.0.0.1:14268/api/traces"},
+		{name: "agent without port", endpoint: "127.0.0.1", mode: JMAgent, err: true},
+		{name: "unknown mode", endpoint: "127.0.0.1:6831", mode: "kafka", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultTraceConfig()
+			cfg.JaegerEndpoint = c.endpoint
+			cfg.JaegerMode = c.mode
+			e, err := newJaegerExporter(cfg)
+			if c.err {
+				if err == nil {
+					t.Error("expect error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = e.Shutdown(context.Background())
+		})
+	}
+}
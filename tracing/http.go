@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/ipfs-force-community/metrics/tracing"
+
+// NewHandler wraps `next` with a middleware, which extracts the trace context from
+// the request headers and handles the request in a server span named by the
+// method, like `HTTP GET`. The path is not in the name, so the raw paths do not
+// blow up the number of span names, use NewNamedHandler to name the route.
+func NewHandler(next http.Handler) http.Handler {
+	return newHandler("", next)
+}
+
+// NewNamedHandler is NewHandler with the span named by `operation`, like the route
+// template `GET /actor/{id}` or a fixed operation name.
+func NewNamedHandler(operation string, next http.Handler) http.Handler {
+	return newHandler(operation, next)
+}
+
+func newHandler(operation string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := operation
+		if name == "" {
+			name = "HTTP " + r.Method
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, name,
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		setStatus(span, sw.status)
+	})
+}
+
+// Transport is a http.RoundTripper, which sends the request in a client span and
+// injects the trace context into the request headers.
+type Transport struct {
+	// Base is the underlying http.RoundTripper, http.DefaultTransport is used if nil.
+	Base http.RoundTripper
+}
+
+// NewTransport returns a Transport wrapping `base`
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{Base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := otel.Tracer(instrumentationName).Start(withOCSpan(r.Context()), "HTTP "+r.Method,
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.url", r.URL.String()),
+		),
+	)
+	defer span.End()
+
+	// a RoundTripper should not modify the request
+	r = r.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	resp, err := base.RoundTrip(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	setStatus(span, resp.StatusCode)
+	return resp, nil
+}
+
+func setStatus(span oteltrace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// statusWriter records the status of the response, it forwards Flush and Hijack
+// to the wrapped writer, so the streaming and websocket handlers still work.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush implements http.Flusher
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
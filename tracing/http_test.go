@@ -0,0 +1,208 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider recording the ended spans
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	tp := tracesdk.NewTracerProvider(tracesdk.WithSpanProcessor(recorder))
+	old := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(old) })
+
+	p, err := NewPropagator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPropagator(t, p)
+	return recorder
+}
+
+func spanAttribute(span tracesdk.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestHandler(t *testing.T) {
+	cases := []struct {
+		name      string
+		operation string
+		status    int
+		want      string
+	}{
+		{name: "named by method", status: http.StatusOK, want: "HTTP POST"},
+		{name: "named by operation", operation: "POST /rpc/{version}", status: http.StatusOK, want: "POST /rpc/{version}"},
+		{name: "server error", status: http.StatusServiceUnavailable, want: "HTTP POST"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			var parent oteltrace.SpanContext
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				parent = oteltrace.SpanFromContext(r.Context()).SpanContext()
+				w.WriteHeader(c.status)
+			})
+			handler := NewHandler(next)
+			if c.operation != "" {
+				handler = NewNamedHandler(c.operation, next)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/rpc/v1", nil)
+			r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("expect 1 span, got %d", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != c.want || span.SpanKind() != oteltrace.SpanKindServer {
+				t.Errorf("expect server span %s, got %s %s", c.want, span.SpanKind(), span.Name())
+			}
+			if span.Parent().SpanID() != testSpanID || span.SpanContext().TraceID() != testTraceID {
+				t.Errorf("expect the child of the remote span, got parent %s", span.Parent().SpanID())
+			}
+			if parent.SpanID() != span.SpanContext().SpanID() {
+				t.Errorf("expect the span in the request context")
+			}
+			if got := spanAttribute(span, "http.target").AsString(); got != "/rpc/v1" {
+				t.Errorf("expect http.target /rpc/v1, got %s", got)
+			}
+			if got := spanAttribute(span, "http.status_code").AsInt64(); got != int64(c.status) {
+				t.Errorf("expect http.status_code %d, got %d", c.status, got)
+			}
+			if wantErr := c.status >= http.StatusInternalServerError; (span.Status().Code == codes.Error) != wantErr {
+				t.Errorf("unexpected span status %+v", span.Status())
+			}
+		})
+	}
+}
+
+// hijackRecorder is a ResponseRecorder supporting hijacking
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	conn net.Conn
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return r.conn, bufio.NewReadWriter(bufio.NewReader(r.conn), bufio.NewWriter(r.conn)), nil
+}
+
+func TestHandlerResponseWriter(t *testing.T) {
+	recordSpans(t)
+	serve := func(w http.ResponseWriter, next http.HandlerFunc) {
+		NewHandler(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	t.Run("flush", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		serve(rec, func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush()
+		})
+		if !rec.Flushed {
+			t.Error("expect the flush to be forwarded")
+		}
+	})
+
+	t.Run("hijack", func(t *testing.T) {
+		conn, peer := net.Pipe()
+		defer conn.Close() //nolint:errcheck
+		defer peer.Close() //nolint:errcheck
+
+		var hijacked net.Conn
+		serve(&hijackRecorder{ResponseRecorder: httptest.NewRecorder(), conn: conn}, func(w http.ResponseWriter, r *http.Request) {
+			c, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+			}
+			hijacked = c
+		})
+		if hijacked != conn {
+			t.Error("expect the connection of the wrapped writer")
+		}
+	})
+
+	t.Run("hijack unsupported", func(t *testing.T) {
+		serve(httptest.NewRecorder(), func(w http.ResponseWriter, r *http.Request) {
+			if _, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				t.Error("expect the error of the writer without hijacking")
+			}
+		})
+	})
+
+	t.Run("unwrap", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		serve(rec, func(w http.ResponseWriter, r *http.Request) {
+			if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != rec {
+				t.Error("expect the wrapped writer")
+			}
+			// http.ResponseController finds the flusher by unwrapping
+			if err := http.NewResponseController(w).Flush(); err != nil {
+				t.Error(err)
+			}
+		})
+		if !rec.Flushed {
+			t.Error("expect the flush to be forwarded")
+		}
+	})
+}
+
+func TestTransport(t *testing.T) {
+	recorder := recordSpans(t)
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	parent.End()
+
+	if r.Header.Get("traceparent") != "" {
+		t.Error("the request is modified")
+	}
+	var client tracesdk.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == oteltrace.SpanKindClient {
+			client = span
+		}
+	}
+	if client == nil {
+		t.Fatal("expect the client span")
+	}
+	if client.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expect the client span to be the child of the parent")
+	}
+	want := "00-" + client.SpanContext().TraceID().String() + "-" + client.SpanContext().SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("expect traceparent %s, got %s", want, traceparent)
+	}
+}
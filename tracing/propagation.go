@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opencensus.io/trace"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/bridge/opencensus"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// PropagatorTraceContext handles the W3C `traceparent` and `tracestate` headers
+	PropagatorTraceContext = "tracecontext"
+	// PropagatorBaggage handles the W3C `baggage` header
+	PropagatorBaggage = "baggage"
+	// PropagatorB3 handles the single `b3` header
+	PropagatorB3 = "b3"
+	// PropagatorB3Multi handles the `X-B3-*` headers
+	PropagatorB3Multi = "b3multi"
+	// PropagatorJaeger handles the `uber-trace-id` header
+	PropagatorJaeger = "jaeger"
+)
+
+// DefaultPropagators is used when no propagator is configured
+var DefaultPropagators = []string{PropagatorTraceContext, PropagatorBaggage}
+
+// NewPropagator composes the propagators of `names` into one, all of them are
+// injected, and the last one found in the carrier wins when extracting.
+func NewPropagator(names ...string) (propagation.TextMapPropagator, error) {
+	if len(names) == 0 {
+		names = DefaultPropagators
+	}
+
+	props := make([]propagation.TextMapPropagator, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case PropagatorTraceContext:
+			props = append(props, propagation.TraceContext{})
+		case PropagatorBaggage:
+			props = append(props, propagation.Baggage{})
+		case PropagatorB3:
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case PropagatorB3Multi:
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case PropagatorJaeger:
+			props = append(props, jaeger.Jaeger{})
+		default:
+			return nil, fmt.Errorf("unknown propagator: %s", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(props...), nil
+}
+
+// InjectMeta injects the trace context of `ctx` into the metadata of a json-rpc request.
+func InjectMeta(ctx context.Context, meta map[string]string) {
+	otel.GetTextMapPropagator().Inject(withOCSpan(ctx), propagation.MapCarrier(meta))
+}
+
+// ExtractMeta extracts the trace context from the metadata of a json-rpc request,
+// the spans started with the returned context are the children of the remote span.
+func ExtractMeta(ctx context.Context, meta map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(meta))
+}
+
+// StartSpan starts an opencensus span, if there is no local span in `ctx` the
+// remote span extracted by the middlewares is used as the parent, so the span
+// does not start a new trace.
+func StartSpan(ctx context.Context, name string, o ...trace.StartOption) (context.Context, *trace.Span) {
+	if trace.FromContext(ctx) == nil {
+		if sc := oteltrace.SpanContextFromContext(ctx); sc.IsValid() {
+			return trace.StartSpanWithRemoteParent(ctx, name, opencensus.OTelSpanContextToOC(sc), o...)
+		}
+	}
+	return trace.StartSpan(ctx, name, o...)
+}
+
+// withOCSpan makes the span started by opencensus visible to the propagators, it
+// is required when the opencensus bridge is not installed.
+func withOCSpan(ctx context.Context) context.Context {
+	if oteltrace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	if span := trace.FromContext(ctx); span != nil {
+		return oteltrace.ContextWithSpanContext(ctx, opencensus.OCSpanContextToOTel(span.SpanContext()))
+	}
+	return ctx
+}
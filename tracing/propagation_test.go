@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	octrace "go.opencensus.io/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	testTraceID = oteltrace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	testSpanID  = oteltrace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+)
+
+func TestPropagators(t *testing.T) {
+	sc := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    testTraceID,
+		SpanID:     testSpanID,
+		TraceFlags: oteltrace.FlagsSampled,
+	})
+
+	cases := []struct {
+		name  string
+		names []string
+		// headers are the values injected by the propagators
+		headers map[string]string
+	}{
+		{
+			name: "default is w3c",
+			headers: map[string]string{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+		},
+		{
+			name:  "b3 single header",
+			names: []string{PropagatorB3},
+			headers: map[string]string{
+				"b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+			},
+		},
+		{
+			name:  "b3 multiple headers",
+			names: []string{PropagatorB3Multi},
+			headers: map[string]string{
+				"X-B3-Traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"X-B3-Spanid":  "00f067aa0ba902b7",
+				"X-B3-Sampled": "1",
+			},
+		},
+		{
+			name:  "jaeger",
+			names: []string{PropagatorJaeger},
+			headers: map[string]string{
+				"Uber-Trace-Id": "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1",
+			},
+		},
+		{
+			name:  "all of the composed propagators are injected",
+			names: []string{PropagatorTraceContext, PropagatorJaeger},
+			headers: map[string]string{
+				"traceparent":   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				"Uber-Trace-Id": "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := NewPropagator(c.names...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header := http.Header{}
+			p.Inject(oteltrace.ContextWithSpanContext(context.Background(), sc), propagation.HeaderCarrier(header))
+			for k, v := range c.headers {
+				if got := header.Get(k); got != v {
+					t.Errorf("expect header %s: %s, got %q", k, v, got)
+				}
+			}
+
+			// only the expected headers are required to extract the span
+			extracted := http.Header{}
+			for k, v := range c.headers {
+				extracted.Set(k, v)
+			}
+			got := oteltrace.SpanContextFromContext(p.Extract(context.Background(), propagation.HeaderCarrier(extracted)))
+			if got.TraceID() != testTraceID || got.SpanID() != testSpanID || !got.IsSampled() || !got.IsRemote() {
+				t.Errorf("the headers are extracted as %+v", got)
+			}
+		})
+	}
+}
+
+func TestNewPropagatorUnknown(t *testing.T) {
+	if _, err := NewPropagator(PropagatorTraceContext, "xray"); err == nil {
+		t.Error("expect the error of the unknown propagator")
+	}
+}
+
+// the trace context is passed by the metadata of the json-rpc requests, and the
+// opencensus spans started with it continue the trace
+func TestMetaPropagation(t *testing.T) {
+	p, err := NewPropagator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPropagator(t, p)
+
+	ctx, span := octrace.StartSpan(context.Background(), "client", octrace.WithSampler(octrace.AlwaysSample()))
+	defer span.End()
+	meta := map[string]string{}
+	InjectMeta(ctx, meta)
+	if meta["traceparent"] == "" {
+		t.Fatalf("expect traceparent in the metadata, got %v", meta)
+	}
+
+	_, child := StartSpan(ExtractMeta(context.Background(), meta), "server")
+	defer child.End()
+	if child.SpanContext().TraceID != span.SpanContext().TraceID {
+		t.Errorf("expect the trace %s to continue, got %s", span.SpanContext().TraceID, child.SpanContext().TraceID)
+	}
+}
+
+func setPropagator(t *testing.T, p propagation.TextMapPropagator) {
+	old := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(p)
+	t.Cleanup(func() { otel.SetTextMapPropagator(old) })
+}
@@ -3,15 +3,88 @@ package metrics
 type ExporterType string
 
 const (
-	ETPrometheus ExporterType = "prometheus"
-	ETGraphite   ExporterType = "graphite"
+	ETPrometheus  ExporterType = "prometheus"
+	ETGraphite    ExporterType = "graphite"
+	ETOTLP        ExporterType = "otlp"
+	ETPushgateway ExporterType = "pushgateway"
+	ETStatsd      ExporterType = "statsd"
+	ETInfluxDB    ExporterType = "influxdb"
 )
 
+type TraceOTLPExporterConfig struct {
+	Endpoint    string            `json:"endpoint" toml:"Endpoint" yaml:"endpoint"`
+	Protocol    OTLPProtocol      `json:"protocol" toml:"Protocol" yaml:"protocol"`
+	Headers     map[string]string `json:"headers" toml:"Headers" yaml:"headers"`
+	Compression string            `json:"compression" toml:"Compression" yaml:"compression"`
+	Insecure    bool              `json:"insecure" toml:"Insecure" yaml:"insecure"`
+}
+
+func newTraceOTLPExporterConfig() *TraceOTLPExporterConfig {
+	return &TraceOTLPExporterConfig{
+		Endpoint:    "localhost:4317",
+		Protocol:    OTLPGRPC,
+		Headers:     map[string]string{},
+		Compression: "none",
+		Insecure:    true,
+	}
+}
+
+type TraceSamplerRule struct {
+	// SpanName matches the span name exactly, or by prefix if it ends with `*`.
+	SpanName string `json:"spanName" toml:"SpanName" yaml:"spanName"`
+	// Attributes must all be set when the span starts, the attributes added
+	// to the span later are not visible to the sampler.
+	Attributes    map[string]string `json:"attributes" toml:"Attributes" yaml:"attributes"`
+	Type          SamplerType       `json:"type" toml:"Type" yaml:"type"`
+	Ratio         float64           `json:"ratio" toml:"Ratio" yaml:"ratio"`
+	RatePerSecond float64           `json:"ratePerSecond" toml:"RatePerSecond" yaml:"ratePerSecond"`
+}
+
+type TraceSamplerConfig struct {
+	// Type is the sampler of the spans not matching any rule, the ratio sampler
+	// samples by ProbabilitySampler of TraceConfig.
+	Type          SamplerType `json:"type" toml:"Type" yaml:"type"`
+	RatePerSecond float64     `json:"ratePerSecond" toml:"RatePerSecond" yaml:"ratePerSecond"`
+	// ParentBased follows the sampling decision of the parent span, Type and
+	// Rules are only used for the root spans.
+	ParentBased bool                `json:"parentBased" toml:"ParentBased" yaml:"parentBased"`
+	Rules       []*TraceSamplerRule `json:"rules" toml:"Rules" yaml:"rules"`
+}
+
+func newTraceSamplerConfig() *TraceSamplerConfig {
+	return &TraceSamplerConfig{
+		Type:          STRatio,
+		RatePerSecond: 0,
+		ParentBased:   true,
+		Rules:         []*TraceSamplerRule{},
+	}
+}
+
 type TraceConfig struct {
-	JaegerTracingEnabled bool    `json:"jaegerTracingEnabled"`
-	ProbabilitySampler   float64 `json:"probabilitySampler"`
-	JaegerEndpoint       string  `json:"jaegerEndpoint"`
-	ServerName           string  `json:"servername"`
+	JaegerTracingEnabled bool    `json:"jaegerTracingEnabled" toml:"JaegerTracingEnabled" yaml:"jaegerTracingEnabled"`
+	ProbabilitySampler   float64 `json:"probabilitySampler" toml:"ProbabilitySampler" yaml:"probabilitySampler"`
+	JaegerEndpoint       string  `json:"jaegerEndpoint" toml:"JaegerEndpoint" yaml:"jaegerEndpoint"`
+	ServerName           string  `json:"servername" toml:"ServerName" yaml:"servername"`
+
+	// JaegerMode is `agent` or `collector`, it is inferred from the scheme and
+	// path of JaegerEndpoint if empty.
+	JaegerMode          JaegerMode `json:"jaegerMode" toml:"JaegerMode" yaml:"jaegerMode"`
+	JaegerMaxPacketSize int        `json:"jaegerMaxPacketSize" toml:"JaegerMaxPacketSize" yaml:"jaegerMaxPacketSize"`
+	JaegerUsername      string     `json:"jaegerUsername" toml:"JaegerUsername" yaml:"jaegerUsername"`
+	JaegerPassword      string     `json:"jaegerPassword" toml:"JaegerPassword" yaml:"jaegerPassword"`
+
+	// TracingEnabled enables the exporter chosen by Exporter, JaegerTracingEnabled
+	// is kept for compatibility and enables it too.
+	TracingEnabled bool                     `json:"tracingEnabled" toml:"TracingEnabled" yaml:"tracingEnabled"`
+	Exporter       TraceExporterType        `json:"exporter" toml:"Exporter" yaml:"exporter"`
+	OTLP           *TraceOTLPExporterConfig `json:"otlp" toml:"OTLP" yaml:"otlp"`
+	ZipkinEndpoint string                   `json:"zipkinEndpoint" toml:"ZipkinEndpoint" yaml:"zipkinEndpoint"`
+
+	// Sampler overrides the plain ratio sampler using ProbabilitySampler
+	Sampler *TraceSamplerConfig `json:"sampler" toml:"Sampler" yaml:"sampler"`
+	// Propagators are the formats of the trace context carried across services,
+	// `tracecontext`, `baggage`, `b3`, `b3multi` and `jaeger` are supported.
+	Propagators []string `json:"propagators" toml:"Propagators" yaml:"propagators"`
 }
 
 func DefaultTraceConfig() *TraceConfig {
@@ -20,15 +93,72 @@ func DefaultTraceConfig() *TraceConfig {
 		JaegerEndpoint:       "localhost:6831",
 		ProbabilitySampler:   1.0,
 		ServerName:           "",
+
+		JaegerMode:          "",
+		JaegerMaxPacketSize: 0,
+		JaegerUsername:      "",
+		JaegerPassword:      "",
+
+		TracingEnabled: false,
+		Exporter:       TETJaeger,
+		OTLP:           newTraceOTLPExporterConfig(),
+		ZipkinEndpoint: "http://localhost:9411/api/v2/spans",
+
+		Sampler:     newTraceSamplerConfig(),
+		Propagators: []string{"tracecontext", "baggage"},
+	}
+}
+
+// TLSConfig enables TLS if CertFile is set, and requires the clients to present
+// a certificate signed by ClientCAFile if it is set.
+type TLSConfig struct {
+	CertFile     string `json:"certFile" toml:"CertFile" yaml:"certFile"`
+	KeyFile      string `json:"keyFile" toml:"KeyFile" yaml:"keyFile"`
+	ClientCAFile string `json:"clientCAFile" toml:"ClientCAFile" yaml:"clientCAFile"`
+}
+
+// DebugConfig selects the debug endpoints served with the metrics
+type DebugConfig struct {
+	// Pprof serves net/http/pprof at /debug/pprof/
+	Pprof bool `json:"pprof" toml:"Pprof" yaml:"pprof"`
+	// ZPages serves the opencensus zpages at /debug/tracez and /debug/rpcz, it
+	// requires importing github.com/ipfs-force-community/metrics/zpages
+	ZPages bool `json:"zPages" toml:"ZPages" yaml:"zPages"`
+	// Expvar serves the exported variables at /debug/vars
+	Expvar bool `json:"expvar" toml:"Expvar" yaml:"expvar"`
+	// Health serves /healthz and /readyz without authentication
+	Health bool `json:"health" toml:"Health" yaml:"health"`
+}
+
+func newDebugConfig() *DebugConfig {
+	return &DebugConfig{
+		Pprof:  false,
+		ZPages: false,
+		Expvar: false,
+		Health: false,
 	}
 }
 
 type MetricsPrometheusExporterConfig struct {
-	RegistryType    string `json:"registryType"`
-	Namespace       string `json:"namespace"`
-	EndPoint        string `json:"endPoint"`
-	Path            string `json:"path"`
-	ReportingPeriod string `json:"reportingPeriod"`
+	RegistryType string `json:"registryType" toml:"RegistryType" yaml:"registryType"`
+	Namespace    string `json:"namespace" toml:"Namespace" yaml:"namespace"`
+	// EndPoint is the multiaddr to listen on, if it is empty the server is not
+	// started, and MetricsHandle.Handler can be mounted on the application router.
+	EndPoint string `json:"endPoint" toml:"EndPoint" yaml:"endPoint"`
+	Path     string `json:"path" toml:"Path" yaml:"path"`
+	// ReportingPeriod is ignored, the metrics are read on each scrape, so the
+	// interval is decided by the scrape config of prometheus.
+	//
+	// Deprecated: the field is kept so the old configs still load, it will be
+	// removed in a future release.
+	ReportingPeriod string `json:"reportingPeriod" toml:"ReportingPeriod" yaml:"reportingPeriod"`
+
+	TLS *TLSConfig `json:"tls" toml:"TLS" yaml:"tls"`
+	// BasicAuthUsers maps the user names to their bcrypt hashed passwords
+	BasicAuthUsers map[string]string `json:"basicAuthUsers" toml:"BasicAuthUsers" yaml:"basicAuthUsers"`
+	BearerToken    string            `json:"bearerToken" toml:"BearerToken" yaml:"bearerToken"`
+
+	Debug *DebugConfig `json:"debug" toml:"Debug" yaml:"debug"`
 }
 
 func newMetricsPrometheusExporterConfig() *MetricsPrometheusExporterConfig {
@@ -37,15 +167,33 @@ func newMetricsPrometheusExporterConfig() *MetricsPrometheusExporterConfig {
 		Namespace:       "",
 		EndPoint:        "/ip4/0.0.0.0/tcp/4568",
 		Path:            "/debug/metrics",
-		ReportingPeriod: "10s",
+		ReportingPeriod: "",
+
+		TLS:            &TLSConfig{},
+		BasicAuthUsers: map[string]string{},
+		BearerToken:    "",
+
+		Debug: newDebugConfig(),
 	}
 }
 
 type MetricsGraphiteExporterConfig struct {
-	Namespace       string `json:"namespace"`
-	Host            string `json:"host"`
-	Port            int    `json:"port"`
-	ReportingPeriod string `json:"reportingPeriod"`
+	Namespace       string `json:"namespace" toml:"Namespace" yaml:"namespace"`
+	Host            string `json:"host" toml:"Host" yaml:"host"`
+	Port            int    `json:"port" toml:"Port" yaml:"port"`
+	ReportingPeriod string `json:"reportingPeriod" toml:"ReportingPeriod" yaml:"reportingPeriod"`
+
+	// Protocol is `tcp` or `udp` for the plaintext protocol, or `pickle`
+	Protocol string `json:"protocol" toml:"Protocol" yaml:"protocol"`
+	// Tagged sends the tags as graphite 1.1 tagged series `name;tag=value`,
+	// otherwise the tag values are appended to the metric path.
+	Tagged bool `json:"tagged" toml:"Tagged" yaml:"tagged"`
+	// BufferSize is the max number of points kept while carbon is unavailable,
+	// the oldest points are dropped when it is full, 0 is the default 10000.
+	BufferSize int `json:"bufferSize" toml:"BufferSize" yaml:"bufferSize"`
+	// ReconnectBackoff and MaxReconnectBackoff default to 1s and 1m if empty
+	ReconnectBackoff    string `json:"reconnectBackoff" toml:"ReconnectBackoff" yaml:"reconnectBackoff"`
+	MaxReconnectBackoff string `json:"maxReconnectBackoff" toml:"MaxReconnectBackoff" yaml:"maxReconnectBackoff"`
 }
 
 func newMetricsGraphiteExporterConfig() *MetricsGraphiteExporterConfig {
@@ -54,28 +202,175 @@ func newMetricsGraphiteExporterConfig() *MetricsGraphiteExporterConfig {
 		Host:            "127.0.0.1",
 		Port:            4568,
 		ReportingPeriod: "10s",
+
+		Protocol:            "tcp",
+		Tagged:              false,
+		BufferSize:          10000,
+		ReconnectBackoff:    "1s",
+		MaxReconnectBackoff: "1m",
+	}
+}
+
+type MetricsOTLPExporterConfig struct {
+	Endpoint     string            `json:"endpoint" toml:"Endpoint" yaml:"endpoint"`
+	Protocol     OTLPProtocol      `json:"protocol" toml:"Protocol" yaml:"protocol"`
+	Headers      map[string]string `json:"headers" toml:"Headers" yaml:"headers"`
+	Compression  string            `json:"compression" toml:"Compression" yaml:"compression"`
+	Insecure     bool              `json:"insecure" toml:"Insecure" yaml:"insecure"`
+	PushInterval string            `json:"pushInterval" toml:"PushInterval" yaml:"pushInterval"`
+}
+
+func newMetricsOTLPExporterConfig() *MetricsOTLPExporterConfig {
+	return &MetricsOTLPExporterConfig{
+		Endpoint:     "localhost:4317",
+		Protocol:     OTLPGRPC,
+		Headers:      map[string]string{},
+		Compression:  "none",
+		Insecure:     true,
+		PushInterval: "10s",
+	}
+}
+
+type MetricsPushgatewayExporterConfig struct {
+	URL       string `json:"url" toml:"URL" yaml:"url"`
+	Namespace string `json:"namespace" toml:"Namespace" yaml:"namespace"`
+	Job       string `json:"job" toml:"Job" yaml:"job"`
+	Instance  string `json:"instance" toml:"Instance" yaml:"instance"`
+	// Grouping are the extra grouping labels besides job and instance
+	Grouping         map[string]string `json:"grouping" toml:"Grouping" yaml:"grouping"`
+	Username         string            `json:"username" toml:"Username" yaml:"username"`
+	Password         string            `json:"password" toml:"Password" yaml:"password"`
+	PushInterval     string            `json:"pushInterval" toml:"PushInterval" yaml:"pushInterval"`
+	DeleteOnShutdown bool              `json:"deleteOnShutdown" toml:"DeleteOnShutdown" yaml:"deleteOnShutdown"`
+}
+
+func newMetricsPushgatewayExporterConfig() *MetricsPushgatewayExporterConfig {
+	return &MetricsPushgatewayExporterConfig{
+		URL:              "http://127.0.0.1:9091",
+		Namespace:        "",
+		Job:              "venus",
+		Instance:         "",
+		Grouping:         map[string]string{},
+		Username:         "",
+		Password:         "",
+		PushInterval:     "10s",
+		DeleteOnShutdown: false,
+	}
+}
+
+type MetricsStatsdExporterConfig struct {
+	// Network is `udp` or `unixgram`
+	Network   string `json:"network" toml:"Network" yaml:"network"`
+	Address   string `json:"address" toml:"Address" yaml:"address"`
+	Namespace string `json:"namespace" toml:"Namespace" yaml:"namespace"`
+	// DogStatsD sends the tags in the DogStatsD format, otherwise the tag
+	// values are appended to the metric name.
+	DogStatsD bool `json:"dogStatsD" toml:"DogStatsD" yaml:"dogStatsD"`
+	// MaxPacketSize is the max size of the packets the metrics are batched into
+	MaxPacketSize   int    `json:"maxPacketSize" toml:"MaxPacketSize" yaml:"maxPacketSize"`
+	ReportingPeriod string `json:"reportingPeriod" toml:"ReportingPeriod" yaml:"reportingPeriod"`
+}
+
+func newMetricsStatsdExporterConfig() *MetricsStatsdExporterConfig {
+	return &MetricsStatsdExporterConfig{
+		Network:         "udp",
+		Address:         "127.0.0.1:8125",
+		Namespace:       "",
+		DogStatsD:       false,
+		MaxPacketSize:   1432,
+		ReportingPeriod: "10s",
+	}
+}
+
+type MetricsInfluxDBExporterConfig struct {
+	// Protocol is `http` for the v2 write api, or `udp`
+	Protocol string `json:"protocol" toml:"Protocol" yaml:"protocol"`
+	// URL, Org, Bucket and Token are used by the http protocol
+	URL    string `json:"url" toml:"URL" yaml:"url"`
+	Org    string `json:"org" toml:"Org" yaml:"org"`
+	Bucket string `json:"bucket" toml:"Bucket" yaml:"bucket"`
+	Token  string `json:"token" toml:"Token" yaml:"token"`
+	// Address and MaxPacketSize are used by the udp protocol
+	Address       string `json:"address" toml:"Address" yaml:"address"`
+	MaxPacketSize int    `json:"maxPacketSize" toml:"MaxPacketSize" yaml:"maxPacketSize"`
+
+	Namespace string `json:"namespace" toml:"Namespace" yaml:"namespace"`
+	// MaxRetries is the max times to retry a failed write, the interval starts
+	// from RetryBackoff and doubles after each retry.
+	MaxRetries      int    `json:"maxRetries" toml:"MaxRetries" yaml:"maxRetries"`
+	RetryBackoff    string `json:"retryBackoff" toml:"RetryBackoff" yaml:"retryBackoff"`
+	ReportingPeriod string `json:"reportingPeriod" toml:"ReportingPeriod" yaml:"reportingPeriod"`
+}
+
+func newMetricsInfluxDBExporterConfig() *MetricsInfluxDBExporterConfig {
+	return &MetricsInfluxDBExporterConfig{
+		Protocol:        "http",
+		URL:             "http://127.0.0.1:8086",
+		Org:             "",
+		Bucket:          "",
+		Token:           "",
+		Address:         "127.0.0.1:8089",
+		MaxPacketSize:   1432,
+		Namespace:       "",
+		MaxRetries:      3,
+		RetryBackoff:    "1s",
+		ReportingPeriod: "10s",
 	}
 }
 
 type MetricsExporterConfig struct {
-	Type ExporterType `json:"type"`
+	// Type is the single exporter to start.
+	//
+	// Deprecated: use Types instead, it is only used when Types is empty.
+	Type ExporterType `json:"type,omitempty" toml:"Type,omitempty" yaml:"type,omitempty"`
+	// Types lists all the exporters to start, each of them is configured by its own field below.
+	Types []ExporterType `json:"types,omitempty" toml:"Types,omitempty" yaml:"types,omitempty"`
 
-	Prometheus *MetricsPrometheusExporterConfig `json:"prometheus"`
-	Graphite   *MetricsGraphiteExporterConfig   `json:"graphite"`
+	Prometheus  *MetricsPrometheusExporterConfig  `json:"prometheus" toml:"Prometheus" yaml:"prometheus"`
+	Graphite    *MetricsGraphiteExporterConfig    `json:"graphite" toml:"Graphite" yaml:"graphite"`
+	OTLP        *MetricsOTLPExporterConfig        `json:"otlp" toml:"OTLP" yaml:"otlp"`
+	Pushgateway *MetricsPushgatewayExporterConfig `json:"pushgateway" toml:"Pushgateway" yaml:"pushgateway"`
+	Statsd      *MetricsStatsdExporterConfig      `json:"statsd" toml:"Statsd" yaml:"statsd"`
+	InfluxDB    *MetricsInfluxDBExporterConfig    `json:"influxdb" toml:"InfluxDB" yaml:"influxdb"`
 }
 
 func newDefaultMetricsExporterConfig() *MetricsExporterConfig {
 	return &MetricsExporterConfig{
 		Type: ETPrometheus,
 
-		Prometheus: newMetricsPrometheusExporterConfig(),
-		Graphite:   newMetricsGraphiteExporterConfig(),
+		Prometheus:  newMetricsPrometheusExporterConfig(),
+		Graphite:    newMetricsGraphiteExporterConfig(),
+		OTLP:        newMetricsOTLPExporterConfig(),
+		Pushgateway: newMetricsPushgatewayExporterConfig(),
+		Statsd:      newMetricsStatsdExporterConfig(),
+		InfluxDB:    newMetricsInfluxDBExporterConfig(),
+	}
+}
+
+// EnabledTypes returns the exporters to start without duplicates, Types takes precedence over Type.
+func (c *MetricsExporterConfig) EnabledTypes() []ExporterType {
+	if len(c.Types) == 0 {
+		if c.Type == "" {
+			return nil
+		}
+		return []ExporterType{c.Type}
+	}
+
+	types := make([]ExporterType, 0, len(c.Types))
+	seen := make(map[ExporterType]struct{}, len(c.Types))
+	for _, t := range c.Types {
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+		types = append(types, t)
 	}
+	return types
 }
 
 type MetricsConfig struct {
-	Enabled  bool                   `json:"enabled"`
-	Exporter *MetricsExporterConfig `json:"exporter"`
+	Enabled  bool                   `json:"enabled" toml:"Enabled" yaml:"enabled"`
+	Exporter *MetricsExporterConfig `json:"exporter" toml:"Exporter" yaml:"exporter"`
 }
 
 func DefaultMetricsConfig() *MetricsConfig {
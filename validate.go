@@ -0,0 +1,390 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ipfs-force-community/metrics/tracing"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// configValidator collects all the problems of a config, each of them is
+// reported with the json path of the field.
+type configValidator struct {
+	errs []error
+}
+
+func (v *configValidator) addf(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (v *configValidator) err() error {
+	return errors.Join(v.errs...)
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func (v *configValidator) duration(path, value string) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		v.addf(path, "invalid duration %q", value)
+		return
+	}
+	if d <= 0 {
+		v.addf(path, "must be positive, got %s", value)
+	}
+}
+
+func (v *configValidator) required(path, value string) bool {
+	if value == "" {
+		v.addf(path, "must not be empty")
+		return false
+	}
+	return true
+}
+
+func (v *configValidator) oneOf(path, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.addf(path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *configValidator) hostPort(path, value string) {
+	if !v.required(path, value) {
+		return
+	}
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		v.addf(path, "invalid address %q, expect host:port", value)
+	}
+}
+
+func (v *configValidator) httpURL(path, value string) {
+	if !v.required(path, value) {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.addf(path, "invalid url %q, expect http(s)://host[:port][/path]", value)
+	}
+}
+
+func (v *configValidator) port(path string, value int) {
+	if value <= 0 || value > 65535 {
+		v.addf(path, "must be in [1, 65535], got %d", value)
+	}
+}
+
+func (v *configValidator) positive(path string, value int) {
+	if value <= 0 {
+		v.addf(path, "must be positive, got %d", value)
+	}
+}
+
+func (v *configValidator) ratio(path string, value float64) {
+	if value < 0 || value > 1 {
+		v.addf(path, "must be in [0, 1], got %v", value)
+	}
+}
+
+func (v *configValidator) compression(path, value string) {
+	v.oneOf(path, value, "", "none", "gzip")
+}
+
+func (v *configValidator) otlpProtocol(path string, value OTLPProtocol) {
+	v.oneOf(path, string(value), string(OTLPGRPC), string(OTLPHTTP))
+}
+
+// Validate reports all the problems of the config at once, the exporter configs
+// are only checked if the metrics and the exporters are enabled.
+func (c *MetricsConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *MetricsConfig) validate(v *configValidator, prefix string) {
+	if !c.Enabled {
+		return
+	}
+	if c.Exporter == nil {
+		v.addf(joinPath(prefix, "exporter"), "must be set if metrics is enabled")
+		return
+	}
+	c.Exporter.validate(v, joinPath(prefix, "exporter"))
+}
+
+// Validate reports all the problems of the enabled exporters at once.
+func (c *MetricsExporterConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *MetricsExporterConfig) validate(v *configValidator, prefix string) {
+	if len(c.Types) == 0 && c.Type != "" && !isExporterType(c.Type) {
+		v.addf(joinPath(prefix, "type"), "invalid exporter type %q", c.Type)
+	}
+	for i, et := range c.Types {
+		if !isExporterType(et) {
+			v.addf(fmt.Sprintf("%s[%d]", joinPath(prefix, "types"), i), "invalid exporter type %q", et)
+		}
+	}
+
+	configs := map[ExporterType]interface {
+		validate(*configValidator, string)
+	}{}
+	if c.Prometheus != nil {
+		configs[ETPrometheus] = c.Prometheus
+	}
+	if c.Graphite != nil {
+		configs[ETGraphite] = c.Graphite
+	}
+	if c.OTLP != nil {
+		configs[ETOTLP] = c.OTLP
+	}
+	if c.Pushgateway != nil {
+		configs[ETPushgateway] = c.Pushgateway
+	}
+	if c.Statsd != nil {
+		configs[ETStatsd] = c.Statsd
+	}
+	if c.InfluxDB != nil {
+		configs[ETInfluxDB] = c.InfluxDB
+	}
+	for _, et := range c.EnabledTypes() {
+		if !isExporterType(et) {
+			continue
+		}
+		cfg, ok := configs[et]
+		if !ok {
+			v.addf(joinPath(prefix, string(et)), "must be set if the %s exporter is enabled", et)
+			continue
+		}
+		cfg.validate(v, joinPath(prefix, string(et)))
+	}
+}
+
+func isExporterType(et ExporterType) bool {
+	switch et {
+	case ETPrometheus, ETGraphite, ETOTLP, ETPushgateway, ETStatsd, ETInfluxDB:
+		return true
+	default:
+		return false
+	}
+}
+
+// Validate reports all the problems of the config at once.
+func (c *MetricsPrometheusExporterConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *MetricsPrometheusExporterConfig) validate(v *configValidator, prefix string) {
+	v.oneOf(joinPath(prefix, "registryType"), c.RegistryType, string(RTDefault), string(RTDefine))
+	if c.EndPoint != "" {
+		if _, err := ma.NewMultiaddr(c.EndPoint); err != nil {
+			v.addf(joinPath(prefix, "endPoint"), "invalid multiaddr %q: %s", c.EndPoint, err)
+		}
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		v.addf(joinPath(prefix, "path"), "must start with /, got %q", c.Path)
+	}
+
+	if c.TLS != nil {
+		if c.TLS.CertFile != "" && c.TLS.KeyFile == "" {
+			v.addf(joinPath(prefix, "tls.keyFile"), "must be set with tls.certFile")
+		}
+		if c.TLS.CertFile == "" && (c.TLS.KeyFile != "" || c.TLS.ClientCAFile != "") {
+			v.addf(joinPath(prefix, "tls.certFile"), "must be set to enable tls")
+		}
+	}
+	for user, hash := range c.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			v.addf(joinPath(prefix, "basicAuthUsers."+user), "must be a bcrypt hash: %s", err)
+		}
+	}
+}
+
+// Validate reports all the problems of the config at once.
+func (c *MetricsGraphiteExporterConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *MetricsGraphiteExporterConfig) validate(v *configValidator, prefix string) {
+	v.required(joinPath(prefix, "host"), c.Host)
+	v.port(joinPath(prefix, "port"), c.Port)
+	v.duration(joinPath(prefix, "reportingPeriod"), c.ReportingPeriod)
+	v.oneOf(joinPath(prefix, "protocol"), c.Protocol, "", "tcp", "udp", "pickle")
+	if c.BufferSize < 0 {
+		v.addf(joinPath(prefix, "bufferSize"), "must not be negative, got %d", c.BufferSize)
+	}
+
+	// the zero buffer size and empty backoffs are the defaults
+	d := c.withDefaults()
+	v.duration(joinPath(prefix, "reconnectBackoff"), d.ReconnectBackoff)
+	v.duration(joinPath(prefix, "maxReconnectBackoff"), d.MaxReconnectBackoff)
+
+	minBackoff, err1 := time.ParseDuration(d.ReconnectBackoff)
+	maxBackoff, err2 := time.ParseDuration(d.MaxReconnectBackoff)
+	if err1 == nil && err2 == nil && maxBackoff < minBackoff {
+		v.addf(joinPath(prefix, "maxReconnectBackoff"), "must not be less than reconnectBackoff")
+	}
+}
+
+// Validate reports all the problems of the config at once.
+func (c *MetricsOTLPExporterConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *MetricsOTLPExporterConfig) validate(v *configValidator, prefix string) {
+	v.required(joinPath(prefix, "endpoint"), c.Endpoint)
+	v.otlpProtocol(joinPath(prefix, "protocol"), c.Protocol)
+	v.compression(joinPath(prefix, "compression"), c.Compression)
+	v.duration(joinPath(prefix, "pushInterval"), c.PushInterval)
+}
+
+// Validate reports all the problems of the config at once.
+func (c *MetricsPushgatewayExporterConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *MetricsPushgatewayExporterConfig) validate(v *configValidator, prefix string) {
+	v.httpURL(joinPath(prefix, "url"), c.URL)
+	v.required(joinPath(prefix, "job"), c.Job)
+	v.duration(joinPath(prefix, "pushInterval"), c.PushInterval)
+	if c.Password != "" && c.Username == "" {
+		v.addf(joinPath(prefix, "username"), "must be set with password")
+	}
+}
+
+// Validate reports all the problems of the config at once.
+func (c *MetricsStatsdExporterConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *MetricsStatsdExporterConfig) validate(v *configValidator, prefix string) {
+	v.oneOf(joinPath(prefix, "network"), c.Network, "udp", "udp4", "udp6", "unixgram")
+	if c.Network == "unixgram" {
+		v.required(joinPath(prefix, "address"), c.Address)
+	} else {
+		v.hostPort(joinPath(prefix, "address"), c.Address)
+	}
+	v.positive(joinPath(prefix, "maxPacketSize"), c.MaxPacketSize)
+	v.duration(joinPath(prefix, "reportingPeriod"), c.ReportingPeriod)
+}
+
+// Validate reports all the problems of the config at once, only the fields of
+// the chosen protocol are checked.
+func (c *MetricsInfluxDBExporterConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *MetricsInfluxDBExporterConfig) validate(v *configValidator, prefix string) {
+	switch c.Protocol {
+	case "http":
+		v.httpURL(joinPath(prefix, "url"), c.URL)
+		v.required(joinPath(prefix, "bucket"), c.Bucket)
+	case "udp":
+		v.hostPort(joinPath(prefix, "address"), c.Address)
+		v.positive(joinPath(prefix, "maxPacketSize"), c.MaxPacketSize)
+	default:
+		v.oneOf(joinPath(prefix, "protocol"), c.Protocol, "http", "udp")
+	}
+	if c.MaxRetries < 0 {
+		v.addf(joinPath(prefix, "maxRetries"), "must not be negative, got %d", c.MaxRetries)
+	}
+	v.duration(joinPath(prefix, "retryBackoff"), c.RetryBackoff)
+	v.duration(joinPath(prefix, "reportingPeriod"), c.ReportingPeriod)
+}
+
+// Validate reports all the problems of the config at once, only the config of
+// the chosen exporter is checked.
+func (c *TraceConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v, "")
+	return v.err()
+}
+
+func (c *TraceConfig) validate(v *configValidator, prefix string) {
+	v.ratio(joinPath(prefix, "probabilitySampler"), c.ProbabilitySampler)
+
+	switch c.Exporter {
+	case TETJaeger, "":
+		switch jaegerMode(c) {
+		case JMAgent:
+			v.hostPort(joinPath(prefix, "jaegerEndpoint"), strings.TrimPrefix(c.JaegerEndpoint, "udp://"))
+		case JMCollector:
+			v.httpURL(joinPath(prefix, "jaegerEndpoint"), jaegerCollectorEndpoint(c.JaegerEndpoint))
+		default:
+			v.oneOf(joinPath(prefix, "jaegerMode"), string(c.JaegerMode), string(JMAgent), string(JMCollector))
+		}
+		if c.JaegerMaxPacketSize < 0 {
+			v.addf(joinPath(prefix, "jaegerMaxPacketSize"), "must not be negative, got %d", c.JaegerMaxPacketSize)
+		}
+	case TETOTLP:
+		if c.OTLP == nil {
+			v.addf(joinPath(prefix, "otlp"), "must be set if the otlp exporter is chosen")
+			break
+		}
+		v.required(joinPath(prefix, "otlp.endpoint"), c.OTLP.Endpoint)
+		v.otlpProtocol(joinPath(prefix, "otlp.protocol"), c.OTLP.Protocol)
+		v.compression(joinPath(prefix, "otlp.compression"), c.OTLP.Compression)
+	case TETZipkin:
+		v.httpURL(joinPath(prefix, "zipkinEndpoint"), c.ZipkinEndpoint)
+	default:
+		v.oneOf(joinPath(prefix, "exporter"), string(c.Exporter), string(TETJaeger), string(TETOTLP), string(TETZipkin))
+	}
+
+	if c.Sampler != nil {
+		validateSampler(v, joinPath(prefix, "sampler"), c.Sampler.Type, c.Sampler.RatePerSecond)
+		for i, r := range c.Sampler.Rules {
+			path := fmt.Sprintf("%s[%d]", joinPath(prefix, "sampler.rules"), i)
+			if r == nil {
+				v.addf(path, "must not be null")
+				continue
+			}
+			v.required(joinPath(path, "spanName"), r.SpanName)
+			validateSampler(v, path, r.Type, r.RatePerSecond)
+			if r.Type == STRatio || r.Type == "" {
+				v.ratio(joinPath(path, "ratio"), r.Ratio)
+			}
+		}
+	}
+
+	for i, name := range c.Propagators {
+		if _, err := tracing.NewPropagator(name); err != nil {
+			v.addf(fmt.Sprintf("%s[%d]", joinPath(prefix, "propagators"), i), "%s", err)
+		}
+	}
+}
+
+func validateSampler(v *configValidator, prefix string, t SamplerType, ratePerSecond float64) {
+	v.oneOf(joinPath(prefix, "type"), string(t), "", string(STAlwaysOn), string(STAlwaysOff), string(STRatio), string(STRateLimiting))
+	if t == STRateLimiting && ratePerSecond <= 0 {
+		v.addf(joinPath(prefix, "ratePerSecond"), "must be positive for the rate_limiting sampler, got %v", ratePerSecond)
+	}
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricsConfigValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(cfg *MetricsConfig)
+		// want are the substrings of the error, empty if the config is valid
+		want []string
+	}{
+		{
+			name:   "default",
+			modify: func(cfg *MetricsConfig) {},
+		},
+		{
+			name: "disabled metrics are not checked",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Enabled = false
+				cfg.Exporter = &MetricsExporterConfig{Type: ETPrometheus}
+			},
+		},
+		{
+			name: "disabled exporters are not checked",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Exporter.Graphite.Port = 0
+			},
+		},
+		{
+			name: "nil exporter of enabled metrics",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Exporter = nil
+			},
+			want: []string{"exporter: must be set if metrics is enabled"},
+		},
+		{
+			name: "invalid exporter type",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Exporter.Types = []ExporterType{ETPrometheus, "kafka"}
+			},
+			want: []string{`exporter.types[1]: invalid exporter type "kafka"`},
+		},
+		{
+			name: "nil config of enabled exporter",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Exporter.Types = []ExporterType{ETStatsd}
+				cfg.Exporter.Statsd = nil
+			},
+			want: []string{"exporter.statsd: must be set if the statsd exporter is enabled"},
+		},
+		{
+			name: "all the problems are reported",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Exporter.Types = []ExporterType{ETPrometheus, ETGraphite}
+				cfg.Exporter.Prometheus.Path = "metrics"
+				cfg.Exporter.Graphite.Port = 70000
+				cfg.Exporter.Graphite.Protocol = "http"
+			},
+			want: []string{
+				`exporter.prometheus.path: must start with /, got "metrics"`,
+				"exporter.graphite.port: must be in [1, 65535], got 70000",
+				`exporter.graphite.protocol: must be one of , tcp, udp, pickle, got "http"`,
+			},
+		},
+		{
+			name: "graphite backoffs",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Exporter.Types = []ExporterType{ETGraphite}
+				cfg.Exporter.Graphite.BufferSize = -1
+				cfg.Exporter.Graphite.ReconnectBackoff = "1m"
+				cfg.Exporter.Graphite.MaxReconnectBackoff = "1s"
+			},
+			want: []string{
+				"exporter.graphite.bufferSize: must not be negative, got -1",
+				"exporter.graphite.maxReconnectBackoff: must not be less than reconnectBackoff",
+			},
+		},
+		{
+			name: "deprecated prometheus reporting period is ignored",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Exporter.Prometheus.ReportingPeriod = "invalid"
+			},
+		},
+		{
+			name: "invalid durations",
+			modify: func(cfg *MetricsConfig) {
+				cfg.Exporter.Types = []ExporterType{ETStatsd, ETPushgateway}
+				cfg.Exporter.Statsd.ReportingPeriod = "10"
+				cfg.Exporter.Pushgateway.PushInterval = "-1s"
+			},
+			want: []string{
+				`exporter.statsd.reportingPeriod: invalid duration "10"`,
+				"exporter.pushgateway.pushInterval: must be positive, got -1s",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultMetricsConfig()
+			cfg.Enabled = true
+			c.modify(cfg)
+			checkValidateErr(t, cfg.Validate(), c.want)
+		})
+	}
+}
+
+func TestTraceConfigValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(cfg *TraceConfig)
+		want   []string
+	}{
+		{
+			name:   "default",
+			modify: func(cfg *TraceConfig) {},
+		},
+		{
+			name: "jaeger collector endpoint without scheme",
+			modify: func(cfg *TraceConfig) {
+				cfg.JaegerEndpoint = "jaeger:14268/api/traces"
+			},
+		},
+		{
+			name: "invalid jaeger agent endpoint",
+			modify: func(cfg *TraceConfig) {
+				cfg.JaegerEndpoint = "jaeger"
+			},
+			want: []string{`jaegerEndpoint: invalid address "jaeger", expect host:port`},
+		},
+		{
+			name: "ratio out of range",
+			modify: func(cfg *TraceConfig) {
+				cfg.ProbabilitySampler = 1.5
+			},
+			want: []string{"probabilitySampler: must be in [0, 1], got 1.5"},
+		},
+		{
+			name: "otlp without endpoint",
+			modify: func(cfg *TraceConfig) {
+				cfg.Exporter = TETOTLP
+				cfg.OTLP.Endpoint = ""
+			},
+			want: []string{"otlp.endpoint: must not be empty"},
+		},
+		{
+			name: "unknown exporter",
+			modify: func(cfg *TraceConfig) {
+				cfg.Exporter = "datadog"
+			},
+			want: []string{`exporter: must be one of jaeger, otlp, zipkin, got "datadog"`},
+		},
+		{
+			name: "sampler rules",
+			modify: func(cfg *TraceConfig) {
+				cfg.Sampler.Type = STRateLimiting
+				cfg.Sampler.Rules = []*TraceSamplerRule{nil, {Type: STRatio, Ratio: 2}}
+			},
+			want: []string{
+				"sampler.ratePerSecond: must be positive for the rate_limiting sampler, got 0",
+				"sampler.rules[0]: must not be null",
+				"sampler.rules[1].spanName: must not be empty",
+				"sampler.rules[1].ratio: must be in [0, 1], got 2",
+			},
+		},
+		{
+			name: "unknown propagator",
+			modify: func(cfg *TraceConfig) {
+				cfg.Propagators = []string{"tracecontext", "xray"}
+			},
+			want: []string{"propagators[1]:"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := DefaultTraceConfig()
+			c.modify(cfg)
+			checkValidateErr(t, cfg.Validate(), c.want)
+		})
+	}
+}
+
+func checkValidateErr(t *testing.T, err error, want []string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Errorf("expect valid, got %s", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("expect %q, got valid", want)
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("expect %q in the error:\n%s", w, err)
+		}
+	}
+}
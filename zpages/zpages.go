@@ -0,0 +1,23 @@
+// Package zpages serves the opencensus zpages on the debug server of the metrics
+// when DebugConfig.ZPages is enabled. It is imported for the side effect:
+//
+//	import _ "github.com/ipfs-force-community/metrics/zpages"
+//
+// The zpages are not served by the metrics package itself, since importing them
+// registers the grpc views and a span exporter, and turns on the span store of
+// opencensus in the whole program.
+package zpages
+
+import (
+	"net/http"
+
+	"go.opencensus.io/zpages"
+
+	"github.com/ipfs-force-community/metrics"
+)
+
+func init() {
+	metrics.ZPagesHandler = func(mux *http.ServeMux) {
+		zpages.Handle(mux, "/debug")
+	}
+}